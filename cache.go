@@ -0,0 +1,382 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/ristretto"
+	"github.com/pghq/go-tea/trail"
+
+	"github.com/pghq/go-store/internal/clone"
+	"github.com/pghq/go-store/internal/key"
+	"github.com/pghq/go-store/internal/size"
+	"github.com/pghq/go-store/provider"
+)
+
+// Cache a cache of query results
+// *ristretto.Cache satisfies this interface and is used by default
+type Cache interface {
+	Get(key interface{}) (interface{}, bool)
+	SetWithTTL(key, value interface{}, cost int64, ttl time.Duration) bool
+	Del(key interface{})
+	Clear()
+}
+
+// newDefaultCache creates the default ristretto cache
+func newDefaultCache(metrics bool) Cache {
+	cache, _ := ristretto.NewCache(&ristretto.Config{
+		NumCounters: 1e7,
+		MaxCost:     1 << 30,
+		BufferItems: 64,
+		Metrics:     metrics,
+	})
+
+	return cache
+}
+
+// cacheEntry a cached query result
+type cacheEntry struct {
+	value       interface{}
+	err         error
+	generations map[string]uint64
+	ttl         time.Duration
+	expires     time.Time
+	cost        int64
+}
+
+// stale checks if the entry is past its time to live and is being served while revalidating
+func (e cacheEntry) stale() bool {
+	return !e.expires.IsZero() && time.Now().After(e.expires)
+}
+
+// txnCache stages the cache writes of a transaction until it commits
+type txnCache struct {
+	lock    sync.Mutex
+	entries map[interface{}]cacheEntry
+	dirty   map[string]struct{}
+	purged  bool
+}
+
+// get gets a staged value
+func (c *txnCache) get(id interface{}) (cacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, present := c.entries[key.Normalize(id)]
+	return entry, present
+}
+
+// stage stages a value
+func (c *txnCache) stage(id interface{}, entry cacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[interface{}]cacheEntry)
+	}
+
+	c.entries[key.Normalize(id)] = entry
+}
+
+// del removes a staged value
+func (c *txnCache) del(id interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.entries, key.Normalize(id))
+}
+
+// write marks the collection as written to by the transaction and removes the staged values reading from it
+func (c *txnCache) write(collection string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.dirty == nil {
+		c.dirty = make(map[string]struct{})
+	}
+
+	c.dirty[collection] = struct{}{}
+	for key, entry := range c.entries {
+		if _, present := entry.generations[collection]; present {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// purge marks every collection as written to by the transaction and removes the staged values
+func (c *txnCache) purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.purged = true
+	c.entries = nil
+}
+
+// written checks if the transaction wrote to any of the collections
+func (c *txnCache) written(snapshot map[string]uint64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.purged {
+		return true
+	}
+
+	for collection := range snapshot {
+		if _, present := c.dirty[collection]; present {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reset discards the staged values
+func (c *txnCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = nil
+}
+
+// publish moves the staged values to the shared cache
+// values reading from collections written to by the transaction are discarded
+func (c *txnCache) publish(s Store) {
+	c.lock.Lock()
+	entries := c.entries
+	c.entries = nil
+	c.lock.Unlock()
+
+	for key, entry := range entries {
+		if !c.written(entry.generations) && s.generations.fresh(entry.generations) {
+			s.cache.SetWithTTL(key, entry, entry.cost, entry.ttl)
+		}
+	}
+}
+
+// generations tracks a version counter per collection
+// bumping a collection invalidates every cached entry that read from it
+type generations struct {
+	lock   sync.Mutex
+	values map[string]uint64
+}
+
+// snapshot gets the current version of the collections
+func (g *generations) snapshot(collections []string) map[string]uint64 {
+	if len(collections) == 0 {
+		return nil
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	snapshot := make(map[string]uint64, len(collections))
+	for _, collection := range collections {
+		snapshot[collection] = g.values[collection]
+	}
+
+	return snapshot
+}
+
+// fresh checks if none of the collections have changed since the snapshot
+func (g *generations) fresh(snapshot map[string]uint64) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for collection, version := range snapshot {
+		if g.values[collection] != version {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bump advances the version of the collections
+func (g *generations) bump(collections ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.values == nil {
+		g.values = make(map[string]uint64)
+	}
+
+	for _, collection := range collections {
+		g.values[collection]++
+	}
+}
+
+// cacheGet gets a cached value discarding entries invalidated by writes
+// within a transaction, values staged by the transaction are preferred and shared
+// values reading from collections the transaction wrote to are ignored
+func (s Store) cacheGet(ctx context.Context, key interface{}) (cacheEntry, bool) {
+	tx, inTx := ctx.Value(contextKey{}).(Txn)
+	if inTx {
+		if entry, present := tx.cache.get(key); present {
+			return entry, true
+		}
+	}
+
+	cv, present := s.cache.Get(key)
+	if !present {
+		return cacheEntry{}, false
+	}
+
+	entry, ok := cv.(cacheEntry)
+	if !ok || !s.generations.fresh(entry.generations) {
+		s.cache.Del(key)
+		return cacheEntry{}, false
+	}
+
+	if inTx && tx.cache.written(entry.generations) {
+		return cacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// cacheSet caches a deep copy of a value read while the collections were at the snapshot versions
+// the cost of the entry is its approximate size in bytes and oversized values are not cached
+func (s Store) cacheSet(ctx context.Context, key, v interface{}, snapshot map[string]uint64, conf QueryConfig) {
+	cost := size.Of(v)
+	if conf.QueryMaxCacheCost > 0 && cost > conf.QueryMaxCacheCost {
+		return
+	}
+
+	entry := cacheEntry{value: clone.Copy(v), generations: snapshot, ttl: conf.QueryTTL, cost: cost}
+	if conf.QueryStaleTTL > 0 {
+		entry.ttl += conf.QueryStaleTTL
+		entry.expires = time.Now().Add(conf.QueryTTL)
+	}
+
+	s.cachePut(ctx, key, entry)
+}
+
+// cacheNotFound caches a not found result
+func (s Store) cacheNotFound(ctx context.Context, key interface{}, err error, snapshot map[string]uint64, conf QueryConfig) {
+	s.cachePut(ctx, key, cacheEntry{err: err, generations: snapshot, ttl: conf.QueryNegativeTTL, cost: 1})
+}
+
+// cachePut caches an entry
+// within a transaction, the entry is staged until the root transaction commits
+func (s Store) cachePut(ctx context.Context, key interface{}, entry cacheEntry) {
+	if tx, ok := ctx.Value(contextKey{}).(Txn); ok {
+		tx.cache.stage(key, entry)
+		return
+	}
+
+	s.cache.SetWithTTL(key, entry, entry.cost, entry.ttl)
+}
+
+// revalidate refreshes a stale cached value in the background
+// refreshes are skipped while one is already in flight for the value or the concurrency limit is reached
+func (s Store) revalidate(op operation, spec provider.Spec, v interface{}, conf QueryConfig) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		return
+	}
+
+	key := newFlightKey(op, spec.Id())
+	if _, loaded := s.revalidating.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	select {
+	case s.revalidations <- struct{}{}:
+	default:
+		s.revalidating.Delete(key)
+		return
+	}
+
+	go func() {
+		defer func() {
+			<-s.revalidations
+			s.revalidating.Delete(key)
+		}()
+
+		span := trail.StartSpan(context.Background(), "Store.Revalidate")
+		defer span.Finish()
+
+		ctx := span.Context()
+		snapshot := s.generations.snapshot(conf.Collections)
+		dst := reflect.New(rv.Type().Elem()).Interface()
+		if err := s.query(ctx, op, spec, dst, QueryConfig{}); err != nil {
+			switch {
+			case !trail.IsNotFound(err):
+				span.Capture(err)
+			case conf.QueryNegativeTTL != 0:
+				s.cacheNotFound(ctx, spec.Id(), err, snapshot, conf)
+			default:
+				s.cache.Del(spec.Id())
+			}
+
+			return
+		}
+
+		s.cacheSet(ctx, spec.Id(), dst, snapshot, conf)
+	}()
+}
+
+// invalidation cached values to evict
+type invalidation struct {
+	Collections []string
+	Keys        []interface{}
+	Purge       bool
+}
+
+// evict evicts the cached values locally
+func (s Store) evict(inv invalidation) {
+	if inv.Purge {
+		s.cache.Clear()
+	}
+
+	for _, id := range inv.Keys {
+		for _, key := range relatedKeys(id) {
+			s.cache.Del(key)
+		}
+	}
+
+	s.generations.bump(inv.Collections...)
+}
+
+// relatedKeys the cache keys of the reads of a spec id, including soft deleted rows, counts and exists checks
+func relatedKeys(id interface{}) []interface{} {
+	var keys []interface{}
+	for _, id := range []interface{}{id, deletedKey(id)} {
+		keys = append(keys, id, key.Derive("count", id), key.Derive("exists", id))
+	}
+
+	return keys
+}
+
+// invalidate evicts cached values by key and the cached entries reading from the collections
+// within a transaction, the invalidation is applied again once the root transaction commits
+func (s Store) invalidate(ctx context.Context, inv invalidation) {
+	tx, ok := ctx.Value(contextKey{}).(Txn)
+	if !ok {
+		s.evict(inv)
+		s.broadcast(ctx, inv)
+		return
+	}
+
+	for _, id := range inv.Keys {
+		for _, key := range relatedKeys(id) {
+			tx.cache.del(key)
+			s.cache.Del(key)
+		}
+	}
+
+	for _, collection := range inv.Collections {
+		tx.cache.write(collection)
+	}
+
+	if inv.Purge {
+		tx.cache.purge()
+	}
+
+	tx.OnCommit(func(ctx context.Context) {
+		s.evict(inv)
+		s.broadcast(ctx, inv)
+	})
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pghq/go-tea/trail"
+)
+
+// errAborted is passed to rollback hooks when a unit of work ends without an error (e.g., a panic)
+var errAborted = trail.NewError("the unit of work was aborted")
+
+// hooks callbacks registered on a unit of work
+type hooks struct {
+	lock     sync.Mutex
+	parent   *hooks
+	commit   []func(ctx context.Context)
+	rollback []func(ctx context.Context, err error)
+}
+
+// onCommit registers a commit callback
+func (h *hooks) onCommit(fn func(ctx context.Context)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.commit = append(h.commit, fn)
+}
+
+// onRollback registers a rollback callback
+func (h *hooks) onRollback(fn func(ctx context.Context, err error)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.rollback = append(h.rollback, fn)
+}
+
+// committed runs the commit callbacks in registration order
+// nested units of work hand their callbacks to the parent instead
+func (h *hooks) committed(ctx context.Context) {
+	h.lock.Lock()
+	commit, rollback := h.commit, h.rollback
+	h.commit, h.rollback = nil, nil
+	h.lock.Unlock()
+
+	if h.parent != nil {
+		h.parent.lock.Lock()
+		defer h.parent.lock.Unlock()
+		h.parent.commit = append(h.parent.commit, commit...)
+		h.parent.rollback = append(h.parent.rollback, rollback...)
+		return
+	}
+
+	for _, fn := range commit {
+		fn := fn
+		recoverHook(ctx, "Txn.OnCommit", func() { fn(ctx) })
+	}
+}
+
+// rolledBack runs the rollback callbacks in registration order and discards the commit callbacks
+func (h *hooks) rolledBack(ctx context.Context, err error) {
+	h.lock.Lock()
+	rollback := h.rollback
+	h.commit, h.rollback = nil, nil
+	h.lock.Unlock()
+
+	if err == nil {
+		err = errAborted
+	}
+
+	for _, fn := range rollback {
+		fn := fn
+		recoverHook(ctx, "Txn.OnRollback", func() { fn(ctx, err) })
+	}
+}
+
+// recoverHook runs a callback recovering from panics
+func recoverHook(ctx context.Context, operation string, fn func()) {
+	span := trail.StartSpan(ctx, operation)
+	defer span.Finish()
+	defer func() {
+		if err := recover(); err != nil {
+			span.Recover(err)
+		}
+	}()
+
+	fn()
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/georgysavva/scany/dbscan"
+	"github.com/pghq/go-tea/trail"
+
+	"github.com/pghq/go-store/internal/clone"
+)
+
+// hydrate Copies a deep copy of the src value to destination
+// values of different types are converted if every column of the destination
+// struct (or slice of structs) is present in the source with the same type
+func hydrate(dst, src interface{}) error {
+	dv := reflect.Indirect(reflect.ValueOf(dst))
+	sv := reflect.Indirect(reflect.ValueOf(src))
+
+	if !dv.CanSet() || !sv.IsValid() {
+		return trail.NewError("bad hydration")
+	}
+
+	cv, ok := convert(sv, dv.Type())
+	if !ok {
+		return trail.NewErrorf("bad hydration: %s is not compatible with %s", sv.Type(), dv.Type())
+	}
+
+	dv.Set(cv)
+	return nil
+}
+
+// convert creates a deep copy of the value as the type
+func convert(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if v.Type() == t {
+		return clone.Value(v), true
+	}
+
+	dst := reflect.New(t).Elem()
+	switch {
+	case v.Kind() == reflect.Ptr && t.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return dst, true
+		}
+
+		ev, ok := convert(v.Elem(), t.Elem())
+		if !ok {
+			return dst, false
+		}
+
+		dst.Set(reflect.New(t.Elem()))
+		dst.Elem().Set(ev)
+	case v.Kind() == reflect.Slice && t.Kind() == reflect.Slice:
+		if v.IsNil() {
+			return dst, true
+		}
+
+		dst.Set(reflect.MakeSlice(t, v.Len(), v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			ev, ok := convert(v.Index(i), t.Elem())
+			if !ok {
+				return dst, false
+			}
+
+			dst.Index(i).Set(ev)
+		}
+	case v.Kind() == reflect.Struct && t.Kind() == reflect.Struct:
+		src := columns(v.Type())
+		for name, df := range columns(t) {
+			sf, present := src[name]
+			if !present {
+				return dst, false
+			}
+
+			field := dst.FieldByIndex(df.index)
+			if sf.typ != field.Type() {
+				return dst, false
+			}
+
+			field.Set(clone.Value(v.FieldByIndex(sf.index)))
+		}
+	default:
+		return dst, false
+	}
+
+	return dst, true
+}
+
+// column a struct field mapped to a column
+type column struct {
+	index []int
+	typ   reflect.Type
+}
+
+// columns maps the columns of a struct to its fields the same way scany does
+// untagged embedded structs are flattened and other struct fields are treated as a single column
+func columns(t reflect.Type) map[string]column {
+	fields := make(map[string]column)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		name, tagged := sf.Tag.Lookup("db")
+		name = strings.Split(name, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if sf.Anonymous && !tagged && sf.Type.Kind() == reflect.Struct {
+			for name, embedded := range columns(sf.Type) {
+				if _, present := fields[name]; !present {
+					fields[name] = column{index: append([]int{i}, embedded.index...), typ: embedded.typ}
+				}
+			}
+
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if !tagged {
+			name = dbscan.SnakeCaseMapper(sf.Name)
+		}
+
+		fields[name] = column{index: sf.Index, typ: sf.Type}
+	}
+
+	return fields
+}
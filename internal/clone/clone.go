@@ -0,0 +1,83 @@
+package clone
+
+import (
+	"reflect"
+)
+
+// Copy creates a deep copy of a value
+// unexported struct fields are copied shallowly as they can not be set using reflection
+func Copy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	return Value(reflect.ValueOf(v)).Interface()
+}
+
+// Value creates a deep copy of a reflected value
+func Value(v reflect.Value) reflect.Value {
+	return copyValue(v, make(map[uintptr]reflect.Value))
+}
+
+// copyValue creates a deep copy of a reflected value
+// pointers already copied are reused so shared and cyclic references are preserved
+func copyValue(v reflect.Value, visited map[uintptr]reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+
+	dst := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return dst
+		}
+
+		if cp, present := visited[v.Pointer()]; present && cp.Type() == v.Type() {
+			return cp
+		}
+
+		cp := reflect.New(v.Type().Elem())
+		visited[v.Pointer()] = cp
+		cp.Elem().Set(copyValue(v.Elem(), visited))
+		return cp
+	case reflect.Interface:
+		if !v.IsNil() {
+			dst.Set(copyValue(v.Elem(), visited))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return dst
+		}
+
+		dst.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			dst.Index(i).Set(copyValue(v.Index(i), visited))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			dst.Index(i).Set(copyValue(v.Index(i), visited))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return dst
+		}
+
+		dst.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+		iter := v.MapRange()
+		for iter.Next() {
+			dst.SetMapIndex(copyValue(iter.Key(), visited), copyValue(iter.Value(), visited))
+		}
+	case reflect.Struct:
+		dst.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if field := dst.Field(i); field.CanSet() {
+				field.Set(copyValue(v.Field(i), visited))
+			}
+		}
+	default:
+		dst.Set(v)
+	}
+
+	return dst
+}
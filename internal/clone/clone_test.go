@@ -0,0 +1,104 @@
+package clone
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	Id       string
+	Tags     []string
+	Meta     map[string]interface{}
+	Parent   *item
+	Created  time.Time
+	Scores   [2]int
+	internal []int
+}
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil", func(t *testing.T) {
+		assert.Nil(t, Copy(nil))
+	})
+
+	t.Run("scalar", func(t *testing.T) {
+		assert.Equal(t, 1, Copy(1))
+	})
+
+	t.Run("nil references", func(t *testing.T) {
+		v := item{}
+		assert.Equal(t, v, Copy(v))
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		v := &item{
+			Id:       "1234",
+			Tags:     []string{"foo"},
+			Meta:     map[string]interface{}{"bar": []int{1}},
+			Parent:   &item{Id: "parent"},
+			Created:  time.Now(),
+			Scores:   [2]int{1, 2},
+			internal: []int{1},
+		}
+
+		cp := Copy(v).(*item)
+		assert.Equal(t, v, cp)
+
+		cp.Tags[0] = "baz"
+		cp.Meta["bar"].([]int)[0] = 2
+		cp.Parent.Id = "other"
+		assert.Equal(t, "foo", v.Tags[0])
+		assert.Equal(t, 1, v.Meta["bar"].([]int)[0])
+		assert.Equal(t, "parent", v.Parent.Id)
+
+		cp.internal[0] = 2
+		assert.Equal(t, 2, v.internal[0])
+	})
+
+	t.Run("slice", func(t *testing.T) {
+		v := []item{{Id: "1234", Tags: []string{"foo"}}}
+		cp := Copy(&v).(*[]item)
+		(*cp)[0].Tags[0] = "bar"
+		assert.Equal(t, "foo", v[0].Tags[0])
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		v := &item{Id: "1234"}
+		v.Parent = v
+
+		cp := Copy(v).(*item)
+		assert.Equal(t, cp, cp.Parent)
+		assert.NotSame(t, v, cp)
+	})
+}
+
+func BenchmarkCopy(b *testing.B) {
+	for _, n := range []int{1, 100, 10000} {
+		v := make([]item, n)
+		for i := range v {
+			v[i] = item{
+				Id:      fmt.Sprintf("item:%d", i),
+				Tags:    []string{"foo", "bar"},
+				Meta:    map[string]interface{}{"baz": i},
+				Created: time.Now(),
+			}
+		}
+
+		b.Run(fmt.Sprintf("shallow/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				cp := v
+				_ = cp
+			}
+		})
+
+		b.Run(fmt.Sprintf("deep/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Copy(&v)
+			}
+		})
+	}
+}
@@ -40,7 +40,7 @@ func Map(v interface{}) (map[string]interface{}, error) {
 	t := rv.Type()
 	for i := 0; i < rv.NumField(); i++ {
 		sf := t.Field(i)
-		key := sf.Tag.Get("db")
+		key := strings.Split(sf.Tag.Get("db"), ",")[0]
 		if key == "" {
 			key = sf.Name
 		}
@@ -49,8 +49,58 @@ func Map(v interface{}) (map[string]interface{}, error) {
 			continue
 		}
 
-		item[strings.Split(key, ",")[0]] = rv.Field(i).Interface()
+		item[key] = rv.Field(i).Interface()
 	}
 
 	return item, nil
 }
+
+// Maps Convert each item of a slice to a map
+func Maps(v interface{}) ([]map[string]interface{}, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, trail.NewErrorf("item of type %T is not a slice", v)
+	}
+
+	items := make([]map[string]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item, err := Map(rv.Index(i).Interface())
+		if err != nil {
+			return nil, trail.Stacktrace(err)
+		}
+
+		items[i] = item
+	}
+
+	return items, nil
+}
+
+// Version Find the field of a struct tagged as its version (e.g., `db:"version,version"`)
+func Version(v interface{}) (string, reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return "", reflect.Value{}, false
+	}
+
+	t := rv.Type()
+	for i := 0; i < rv.NumField(); i++ {
+		sf := t.Field(i)
+		parts := strings.Split(sf.Tag.Get("db"), ",")
+		for _, opt := range parts[1:] {
+			if opt == "version" {
+				name := parts[0]
+				if name == "" {
+					name = sf.Name
+				}
+
+				return name, rv.Field(i), true
+			}
+		}
+	}
+
+	return "", reflect.Value{}, false
+}
@@ -49,6 +49,15 @@ func TestMap(t *testing.T) {
 		assert.Equal(t, map[string]interface{}{"field1": 1, "field2": 2, "Field4": 4}, m)
 	})
 
+	t.Run("struct tag options only", func(t *testing.T) {
+		v := struct {
+			Version int `db:",version"`
+		}{Version: 1}
+
+		m, _ := Map(&v)
+		assert.Equal(t, map[string]interface{}{"Version": 1}, m)
+	})
+
 	t.Run("struct slice", func(t *testing.T) {
 		type value struct {
 			Field1 int `db:"field1"`
@@ -68,3 +77,69 @@ func TestMap(t *testing.T) {
 		assert.Equal(t, map[string]interface{}{"field1": 0, "field2": 0, "Field4": 0}, m)
 	})
 }
+
+func TestMaps(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not a slice", func(t *testing.T) {
+		_, err := Maps(map[string]interface{}{"id": "foo"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("bad item", func(t *testing.T) {
+		_, err := Maps([]interface{}{func() {}})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("maps", func(t *testing.T) {
+		m, _ := Maps([]map[string]interface{}{{"id": "foo"}, {"id": "bar"}})
+		assert.Equal(t, []map[string]interface{}{{"id": "foo"}, {"id": "bar"}}, m)
+	})
+
+	t.Run("struct slice pointer", func(t *testing.T) {
+		type value struct {
+			Field1 int `db:"field1"`
+			Field2 int `db:"-"`
+		}
+
+		m, _ := Maps(&[]value{{Field1: 1, Field2: 2}, {Field1: 3}})
+		assert.Equal(t, []map[string]interface{}{{"field1": 1}, {"field1": 3}}, m)
+	})
+}
+
+func TestVersion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not a struct", func(t *testing.T) {
+		_, _, ok := Version(map[string]interface{}{"version": 1})
+		assert.False(t, ok)
+	})
+
+	t.Run("no version", func(t *testing.T) {
+		_, _, ok := Version(struct {
+			Field1 int `db:"field1,transient"`
+		}{})
+		assert.False(t, ok)
+	})
+
+	t.Run("struct pointer", func(t *testing.T) {
+		v := struct {
+			Field1  int `db:"field1"`
+			Version int `db:"version,version"`
+		}{Version: 2}
+
+		name, field, ok := Version(&v)
+		assert.True(t, ok)
+		assert.Equal(t, "version", name)
+		assert.Equal(t, int64(2), field.Int())
+		assert.True(t, field.CanSet())
+	})
+
+	t.Run("default name", func(t *testing.T) {
+		name, _, ok := Version(struct {
+			Rev int `db:",version"`
+		}{})
+		assert.True(t, ok)
+		assert.Equal(t, "Rev", name)
+	})
+}
@@ -0,0 +1,22 @@
+package key
+
+import (
+	"fmt"
+)
+
+// Normalize converts an id to a key usable in maps
+// []byte ids are accepted by ristretto but are not hashable, so they are converted to strings
+func Normalize(id interface{}) interface{} {
+	if b, ok := id.([]byte); ok {
+		return string(b)
+	}
+
+	return id
+}
+
+// Derive creates the key of a read derived from another by kind (e.g., counts)
+// the kind and type of the id are included so derived keys do not collide with each other or with user ids
+func Derive(kind string, id interface{}) string {
+	id = Normalize(id)
+	return fmt.Sprintf("\x00%s\x00%T\x00%v", kind, id, id)
+}
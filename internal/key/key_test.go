@@ -0,0 +1,43 @@
+package key
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	t.Run("bytes", func(t *testing.T) {
+		m := map[interface{}]struct{}{Normalize([]byte("foo")): {}}
+		_, present := m["foo"]
+		assert.True(t, present)
+	})
+
+	t.Run("other", func(t *testing.T) {
+		assert.Equal(t, 1234, Normalize(1234))
+		assert.Equal(t, "foo", Normalize("foo"))
+	})
+}
+
+func TestDerive(t *testing.T) {
+	t.Parallel()
+
+	t.Run("kinds", func(t *testing.T) {
+		assert.NotEqual(t, Derive("count", "foo"), Derive("exists", "foo"))
+	})
+
+	t.Run("types", func(t *testing.T) {
+		assert.NotEqual(t, Derive("count", 1234), Derive("count", "1234"))
+	})
+
+	t.Run("user ids", func(t *testing.T) {
+		assert.NotEqual(t, "count:1234", Derive("count", 1234))
+		assert.NotEqual(t, Derive("count", "1234"), Derive("count", "count:1234"))
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		assert.Equal(t, Derive("count", "foo"), Derive("count", []byte("foo")))
+	})
+}
@@ -0,0 +1,48 @@
+package singleflight
+
+import (
+	"sync"
+)
+
+// Group deduplicates concurrent calls sharing a key
+type Group struct {
+	lock  sync.Mutex
+	calls map[interface{}]*call
+}
+
+// call an in-flight or completed call
+type call struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// Do runs fn once for concurrent callers with the same key
+// shared reports whether the result was produced by another caller
+func (g *Group) Do(key interface{}, fn func() (interface{}, error)) (value interface{}, shared bool, err error) {
+	g.lock.Lock()
+	if g.calls == nil {
+		g.calls = make(map[interface{}]*call)
+	}
+
+	if c, present := g.calls[key]; present {
+		g.lock.Unlock()
+		c.wg.Wait()
+		return c.value, true, c.err
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.lock.Unlock()
+
+	defer func() {
+		g.lock.Lock()
+		delete(g.calls, key)
+		g.lock.Unlock()
+		c.wg.Done()
+	}()
+
+	c.value, c.err = fn()
+	return c.value, false, c.err
+}
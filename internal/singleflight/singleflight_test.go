@@ -0,0 +1,75 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroup_Do(t *testing.T) {
+	t.Parallel()
+
+	t.Run("error", func(t *testing.T) {
+		g := Group{}
+		_, shared, err := g.Do("key", func() (interface{}, error) {
+			return nil, errors.New("an error has occurred")
+		})
+		assert.NotNil(t, err)
+		assert.False(t, shared)
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		g := Group{}
+		var calls int
+		for i := 0; i < 2; i++ {
+			v, shared, err := g.Do("key", func() (interface{}, error) {
+				calls++
+				return calls, nil
+			})
+			assert.Nil(t, err)
+			assert.False(t, shared)
+			assert.Equal(t, i+1, v)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		g := Group{}
+		var calls, sharedCalls int32
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		go func() {
+			_, _, _ = g.Do("key", func() (interface{}, error) {
+				close(started)
+				<-release
+				atomic.AddInt32(&calls, 1)
+				return "value", nil
+			})
+		}()
+
+		<-started
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, shared, err := g.Do("key", func() (interface{}, error) {
+					atomic.AddInt32(&calls, 1)
+					return "value", nil
+				})
+				assert.Nil(t, err)
+				assert.Equal(t, "value", v)
+				if shared {
+					atomic.AddInt32(&sharedCalls, 1)
+				}
+			}()
+		}
+
+		close(release)
+		wg.Wait()
+		assert.Equal(t, calls, 1+10-sharedCalls)
+	})
+}
@@ -0,0 +1,71 @@
+package size
+
+import (
+	"reflect"
+)
+
+// Of approximates the number of bytes used by a value including the memory it references
+// memory referenced more than once is counted once and map overhead is not included
+func Of(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+
+	rv := reflect.ValueOf(v)
+	return int64(rv.Type().Size()) + referenced(rv, make(map[uintptr]struct{}))
+}
+
+// referenced approximates the number of bytes referenced by a value
+func referenced(v reflect.Value, visited map[uintptr]struct{}) int64 {
+	var n int64
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return 0
+		}
+
+		if _, present := visited[v.Pointer()]; present {
+			return 0
+		}
+
+		visited[v.Pointer()] = struct{}{}
+		n += int64(v.Type().Elem().Size()) + referenced(v.Elem(), visited)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+
+		n += int64(v.Elem().Type().Size()) + referenced(v.Elem(), visited)
+	case reflect.String:
+		n += int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() {
+			return 0
+		}
+
+		n += int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			n += referenced(v.Index(i), visited)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			n += referenced(v.Index(i), visited)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return 0
+		}
+
+		iter := v.MapRange()
+		for iter.Next() {
+			n += int64(iter.Key().Type().Size()) + referenced(iter.Key(), visited)
+			n += int64(iter.Value().Type().Size()) + referenced(iter.Value(), visited)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			n += referenced(v.Field(i), visited)
+		}
+	}
+
+	return n
+}
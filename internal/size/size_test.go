@@ -0,0 +1,48 @@
+package size
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOf(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil", func(t *testing.T) {
+		assert.Equal(t, int64(0), Of(nil))
+	})
+
+	t.Run("scalar", func(t *testing.T) {
+		assert.Equal(t, int64(8), Of(int64(1)))
+	})
+
+	t.Run("string", func(t *testing.T) {
+		assert.Equal(t, int64(16+4), Of("1234"))
+	})
+
+	t.Run("struct pointer", func(t *testing.T) {
+		type item struct {
+			Id   string
+			Tags []string
+		}
+
+		v := &item{Id: "1234", Tags: []string{"foo"}}
+		assert.Equal(t, int64(8+40+4+16+3), Of(v))
+	})
+
+	t.Run("shared pointers", func(t *testing.T) {
+		v := new(int64)
+		assert.Equal(t, int64(24+2*8+8), Of([]*int64{v, v}))
+	})
+
+	t.Run("map", func(t *testing.T) {
+		assert.Equal(t, int64(8+16+3+16+16+3), Of(map[string]interface{}{"foo": "bar"}))
+	})
+
+	t.Run("grows with rows", func(t *testing.T) {
+		small := make([]struct{ Id string }, 10)
+		large := make([]struct{ Id string }, 10000)
+		assert.Greater(t, Of(large), 100*Of(small))
+	})
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pghq/go-tea/trail"
+
+	"github.com/pghq/go-store/provider"
+)
+
+// maxNotificationSize the maximum size of notification payloads accepted by postgres
+const maxNotificationSize = 8000
+
+// notification an invalidation broadcast to other store instances
+// only string keys survive encoding, other key types are broadcast as a purge
+type notification struct {
+	Origin      string   `json:"origin"`
+	Collections []string `json:"collections,omitempty"`
+	Keys        []string `json:"keys,omitempty"`
+	Purge       bool     `json:"purge,omitempty"`
+}
+
+// broadcaster broadcasts cache invalidations across store instances
+type broadcaster struct {
+	notifier provider.Notifier
+	channel  string
+	origin   string
+	stop     context.CancelFunc
+}
+
+// newBroadcaster creates a new broadcaster listening on the channel
+func newBroadcaster(db provider.Provider, channel string) *broadcaster {
+	notifier, ok := db.(provider.Notifier)
+	if channel == "" || !ok {
+		return nil
+	}
+
+	origin := make([]byte, 16)
+	_, _ = rand.Read(origin)
+	return &broadcaster{
+		notifier: notifier,
+		channel:  channel,
+		origin:   hex.EncodeToString(origin),
+	}
+}
+
+// broadcast sends the invalidation to other store instances
+func (s Store) broadcast(ctx context.Context, inv invalidation) {
+	if s.broadcaster == nil {
+		return
+	}
+
+	n := notification{
+		Origin:      s.broadcaster.origin,
+		Collections: inv.Collections,
+		Purge:       inv.Purge,
+	}
+
+	for _, key := range inv.Keys {
+		key, ok := key.(string)
+		if !ok {
+			n = notification{Origin: n.Origin, Purge: true}
+			break
+		}
+
+		n.Keys = append(n.Keys, key)
+	}
+
+	payload, _ := json.Marshal(n)
+	if len(payload) >= maxNotificationSize {
+		payload, _ = json.Marshal(notification{Origin: n.Origin, Purge: true})
+	}
+
+	if err := s.broadcaster.notifier.Notify(ctx, s.broadcaster.channel, string(payload)); err != nil {
+		trail.Warnf("store: cache invalidation broadcast failed: %s", err)
+	}
+}
+
+// listen evicts cached values invalidated by other store instances until the context is canceled
+func (s Store) listen(ctx context.Context) {
+	for {
+		err := s.broadcaster.notifier.Listen(ctx, s.broadcaster.channel, func(payload string) {
+			var n notification
+			if err := json.Unmarshal([]byte(payload), &n); err != nil || n.Origin == s.broadcaster.origin {
+				return
+			}
+
+			inv := invalidation{Collections: n.Collections, Purge: n.Purge}
+			for _, key := range n.Keys {
+				inv.Keys = append(inv.Keys, key)
+			}
+
+			s.evict(inv)
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// invalidations may have been missed while disconnected
+		trail.Warnf("store: cache invalidation listener failed: %s", err)
+		s.cache.Clear()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
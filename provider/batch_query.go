@@ -41,6 +41,16 @@ func (b *BatchQuery) All(spec Spec, v interface{}, opts ...BatchQueryOption) {
 	*b = append(*b, &item)
 }
 
+// Count append a query counting the results of the spec
+func (b *BatchQuery) Count(spec Spec, v *int64, opts ...BatchQueryOption) {
+	b.One(CountSpec{Spec: spec}, v, opts...)
+}
+
+// Exists append a query checking if the spec has any results
+func (b *BatchQuery) Exists(spec Spec, v *bool, opts ...BatchQueryOption) {
+	b.One(ExistsSpec{Spec: spec}, v, opts...)
+}
+
 // BatchQueryOption for custom query configuration
 type BatchQueryOption func(item *BatchQueryItem)
 
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/pghq/go-store/internal/key"
 )
 
 func TestBatchQuery_One(t *testing.T) {
@@ -25,3 +27,29 @@ func TestBatchQuery_All(t *testing.T) {
 		assert.NotEmpty(t, batch)
 	})
 }
+
+func TestBatchQuery_Count(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		var n int64
+		batch := BatchQuery{}
+		batch.Count(NewSpec("spec", nil), &n)
+		assert.Len(t, batch, 1)
+		assert.True(t, batch[0].One)
+		assert.Equal(t, key.Derive("count", "spec"), batch[0].Spec.Id())
+	})
+}
+
+func TestBatchQuery_Exists(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		var exists bool
+		batch := BatchQuery{}
+		batch.Exists(NewSpec("spec", nil), &exists)
+		assert.Len(t, batch, 1)
+		assert.True(t, batch[0].One)
+		assert.Equal(t, key.Derive("exists", "spec"), batch[0].Spec.Id())
+	})
+}
@@ -0,0 +1,67 @@
+package provider
+
+// BatchWriteKind the kind of write op
+type BatchWriteKind int
+
+const (
+	// BatchAdd inserts a value into the collection
+	BatchAdd BatchWriteKind = iota
+
+	// BatchEdit updates values matching the spec
+	BatchEdit
+
+	// BatchRemove deletes values matching the spec
+	BatchRemove
+)
+
+// BatchWriteItem a single batch write
+// the batch is applied atomically: if any item fails, the writes of the other items are not kept
+// and they report an error instead of their rows affected
+type BatchWriteItem struct {
+	Kind         BatchWriteKind
+	Collection   string
+	Spec         Spec
+	Value        interface{}
+	Err          error
+	RowsAffected int64
+}
+
+// BatchWrite a list of batch write items
+type BatchWrite []*BatchWriteItem
+
+// Add append an insert of a value into the collection
+func (b *BatchWrite) Add(collection string, v interface{}) *BatchWriteItem {
+	item := BatchWriteItem{
+		Kind:       BatchAdd,
+		Collection: collection,
+		Value:      v,
+	}
+
+	*b = append(*b, &item)
+	return &item
+}
+
+// Edit append an update of values in the collection
+func (b *BatchWrite) Edit(collection string, spec Spec, v interface{}) *BatchWriteItem {
+	item := BatchWriteItem{
+		Kind:       BatchEdit,
+		Collection: collection,
+		Spec:       spec,
+		Value:      v,
+	}
+
+	*b = append(*b, &item)
+	return &item
+}
+
+// Remove append a delete of values in the collection
+func (b *BatchWrite) Remove(collection string, spec Spec) *BatchWriteItem {
+	item := BatchWriteItem{
+		Kind:       BatchRemove,
+		Collection: collection,
+		Spec:       spec,
+	}
+
+	*b = append(*b, &item)
+	return &item
+}
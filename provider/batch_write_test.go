@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWrite_Add(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		batch := BatchWrite{}
+		item := batch.Add("tests", nil)
+		assert.Equal(t, BatchWrite{item}, batch)
+		assert.Equal(t, BatchAdd, item.Kind)
+	})
+}
+
+func TestBatchWrite_Edit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		batch := BatchWrite{}
+		item := batch.Edit("tests", nil, nil)
+		assert.Equal(t, BatchWrite{item}, batch)
+		assert.Equal(t, BatchEdit, item.Kind)
+	})
+}
+
+func TestBatchWrite_Remove(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		batch := BatchWrite{}
+		item := batch.Remove("tests", nil)
+		assert.Equal(t, BatchWrite{item}, batch)
+		assert.Equal(t, BatchRemove, item.Kind)
+	})
+}
@@ -8,10 +8,26 @@ import (
 const (
 	// ErrCodeUniqueViolation expected pg error code for unique violations
 	ErrCodeUniqueViolation = "23505"
+
+	// ErrCodeSerializationFailure expected pg error code for serialization failures
+	ErrCodeSerializationFailure = "40001"
+
+	// ErrCodeDeadlockDetected expected pg error code for deadlocks
+	ErrCodeDeadlockDetected = "40P01"
 )
 
-// IsErrorCode checks if error code matches underlying pg code
-func IsErrorCode(err error, code string) bool {
+// IsErrorCode checks if error code matches any of the underlying pg codes
+func IsErrorCode(err error, codes ...string) bool {
 	var icv *pgconn.PgError
-	return err != nil && trail.AsError(err, &icv) && code == icv.Code
+	if err == nil || !trail.AsError(err, &icv) {
+		return false
+	}
+
+	for _, code := range codes {
+		if code == icv.Code {
+			return true
+		}
+	}
+
+	return false
 }
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/jackc/pgconn"
@@ -13,4 +14,15 @@ func TestIsErrorCode(t *testing.T) {
 	t.Run("unique violation", func(t *testing.T) {
 		assert.True(t, IsErrorCode(&pgconn.PgError{Code: ErrCodeUniqueViolation}, ErrCodeUniqueViolation))
 	})
+
+	t.Run("any of", func(t *testing.T) {
+		err := &pgconn.PgError{Code: ErrCodeDeadlockDetected}
+		assert.True(t, IsErrorCode(err, ErrCodeSerializationFailure, ErrCodeDeadlockDetected))
+		assert.False(t, IsErrorCode(err, ErrCodeUniqueViolation))
+	})
+
+	t.Run("not a pg error", func(t *testing.T) {
+		assert.False(t, IsErrorCode(nil, ErrCodeUniqueViolation))
+		assert.False(t, IsErrorCode(errors.New("an error has occurred"), ErrCodeUniqueViolation))
+	})
 }
@@ -20,7 +20,7 @@ type Provider struct {
 }
 
 func (p Provider) Repository() provider.Repository {
-	return repository(p)
+	return repository{db: p.db}
 }
 
 func (p Provider) Begin(ctx context.Context, opts ...provider.TxOption) (provider.UnitOfWork, error) {
@@ -29,11 +29,22 @@ func (p Provider) Begin(ctx context.Context, opts ...provider.TxOption) (provide
 		opt(&conf)
 	}
 
-	pgxOpts := pgx.TxOptions{}
+	if err := conf.Validate(); err != nil {
+		return nil, trail.Stacktrace(err)
+	}
+
+	pgxOpts := pgx.TxOptions{
+		IsoLevel: pgx.TxIsoLevel(conf.Isolation),
+	}
+
 	if conf.ReadOnly {
 		pgxOpts.AccessMode = pgx.ReadOnly
 	}
 
+	if conf.Deferrable {
+		pgxOpts.DeferrableMode = pgx.Deferrable
+	}
+
 	tx, err := p.db.BeginTx(ctx, pgxOpts)
 	if err != nil {
 		return nil, trail.Stacktrace(err)
@@ -42,6 +53,39 @@ func (p Provider) Begin(ctx context.Context, opts ...provider.TxOption) (provide
 	return unitOfWork{tx: tx}, nil
 }
 
+// Notify sends a notification to the listeners of the channel
+func (p Provider) Notify(ctx context.Context, channel, payload string) error {
+	_, err := p.db.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return trail.Stacktrace(err)
+}
+
+// Listen calls fn with the payload of each notification on the channel
+// blocks on a pooled connection until the context is canceled or the connection fails
+// the connection is closed rather than returned to the pool when done
+func (p Provider) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	pc, err := p.db.Acquire(ctx)
+	if err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	defer pc.Release()
+	conn := pc.Conn()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return trail.Stacktrace(err)
+		}
+
+		fn(notification.Payload)
+	}
+}
+
 // New creates a new pg database provider
 func New(dsn string, migrations fs.FS, opts ...Option) (*Provider, error) {
 	conf := ProviderConfig{
@@ -113,6 +157,21 @@ type unitOfWork struct {
 	tx pgx.Tx
 }
 
+func (u unitOfWork) Repository() provider.Repository {
+	return repository{db: u.tx}
+}
+
+// Savepoint starts a nested unit of work backed by a SAVEPOINT
+// committing releases the savepoint and rolling back reverts to it
+func (u unitOfWork) Savepoint(ctx context.Context) (provider.UnitOfWork, error) {
+	tx, err := u.tx.Begin(ctx)
+	if err != nil {
+		return nil, trail.Stacktrace(err)
+	}
+
+	return unitOfWork{tx: tx}, nil
+}
+
 func (u unitOfWork) Commit(ctx context.Context) error {
 	return u.tx.Commit(ctx)
 }
@@ -85,15 +85,125 @@ func TestProvider_Begin(t *testing.T) {
 		assert.NotNil(t, err)
 	})
 
+	t.Run("rollback", func(t *testing.T) {
+		uow, err := db.Begin(context.TODO())
+		assert.Nil(t, err)
+		assert.Nil(t, uow.Repository().Add(context.TODO(), "tests", map[string]interface{}{"id": "begin.rollback:1234"}))
+		uow.Rollback(context.TODO())
+
+		var v struct{ Id string }
+		err = db.Repository().One(context.TODO(), spec("SELECT id FROM tests WHERE id = 'begin.rollback:1234'"), &v)
+		assert.True(t, trail.IsNotFound(err))
+	})
+
+	t.Run("bad options", func(t *testing.T) {
+		_, err := db.Begin(context.TODO(), provider.WithDeferrable(true))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("isolation", func(t *testing.T) {
+		uow, err := db.Begin(context.TODO(),
+			provider.WithIsolation(provider.Serializable),
+			provider.WithReadOnly(true),
+			provider.WithDeferrable(true),
+		)
+		assert.Nil(t, err)
+		defer uow.Rollback(context.TODO())
+
+		var v struct{ Level string }
+		assert.Nil(t, uow.Repository().One(context.TODO(), spec("SELECT current_setting('transaction_isolation') AS level"), &v))
+		assert.Equal(t, "serializable", v.Level)
+	})
+
+	t.Run("savepoint", func(t *testing.T) {
+		uow, err := db.Begin(context.TODO())
+		assert.Nil(t, err)
+		defer uow.Rollback(context.TODO())
+
+		sp, err := uow.Savepoint(context.TODO())
+		assert.Nil(t, err)
+		assert.Nil(t, sp.Repository().Add(context.TODO(), "tests", map[string]interface{}{"id": "begin.savepoint:1234"}))
+		sp.Rollback(context.TODO())
+
+		sp, err = uow.Savepoint(context.TODO())
+		assert.Nil(t, err)
+		assert.Nil(t, sp.Repository().Add(context.TODO(), "tests", map[string]interface{}{"id": "begin.savepoint:12345"}))
+		assert.Nil(t, sp.Commit(context.TODO()))
+
+		var v []struct{ Id string }
+		assert.Nil(t, uow.Repository().All(context.TODO(), spec("SELECT id FROM tests WHERE id LIKE 'begin.savepoint:%'"), &v))
+		assert.Equal(t, []struct{ Id string }{{Id: "begin.savepoint:12345"}}, v)
+	})
+
+	t.Run("savepoint on closed transaction", func(t *testing.T) {
+		uow, _ := db.Begin(context.TODO())
+		uow.Rollback(context.TODO())
+		_, err := uow.Savepoint(context.TODO())
+		assert.NotNil(t, err)
+	})
+
 	t.Run("ok", func(t *testing.T) {
 		uow, err := db.Begin(context.TODO(), provider.WithReadOnly(true))
 		assert.Nil(t, err)
 		assert.NotNil(t, uow)
 		defer uow.Rollback(context.TODO())
+		assert.NotNil(t, uow.Repository())
 		assert.Nil(t, uow.Commit(context.TODO()))
 	})
 }
 
+func TestProvider_Listen(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("bad context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.TODO(), 1)
+		defer cancel()
+		assert.NotNil(t, db.Listen(ctx, "listen", func(string) {}))
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+
+		payloads := make(chan string, 1)
+		done := make(chan error)
+		go func() {
+			done <- db.Listen(ctx, "listen.ok", func(payload string) {
+				payloads <- payload
+			})
+		}()
+
+		assert.Eventually(t, func() bool {
+			_ = db.Notify(context.TODO(), "listen.ok", "1234")
+			select {
+			case payload := <-payloads:
+				return payload == "1234"
+			default:
+				return false
+			}
+		}, 10*time.Second, 100*time.Millisecond)
+
+		cancel()
+		assert.NotNil(t, <-done)
+	})
+}
+
+func TestProvider_Notify(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("bad context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.TODO(), 1)
+		defer cancel()
+		assert.NotNil(t, db.Notify(ctx, "notify", ""))
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		assert.Nil(t, db.Notify(context.TODO(), "notify", "1234"))
+	})
+}
+
 func TestProvider_Repository(t *testing.T) {
 	trail.Testing()
 	t.Parallel()
@@ -2,9 +2,14 @@ package pg
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/pghq/go-tea/trail"
 
@@ -19,9 +24,29 @@ var (
 
 	// ErrUnique is return for write ops that violate unique constraint
 	ErrUnique = trail.NewErrorConflict("an item already exists matching your request")
+
+	// ErrRolledBack is set on batch write items rolled back due to the failure of a later item
+	ErrRolledBack = trail.NewError("the item was rolled back as another item in the batch failed")
+
+	// ErrNotExecuted is set on batch write items skipped due to the failure of an earlier item
+	ErrNotExecuted = trail.NewError("the item was not executed as an earlier item in the batch failed")
+
+	// ErrConflict is returned for versioned write ops on items modified since they were read
+	ErrConflict = trail.NewErrorConflict("the item was modified by another request")
 )
 
-type repository Provider
+// copyThreshold the minimum number of rows to bulk insert with COPY instead of INSERT
+const copyThreshold = 100
+
+// IsRetryable checks if the error is a transient failure resolved by retrying the transaction
+func IsRetryable(err error) bool {
+	return internal.IsErrorCode(err, internal.ErrCodeSerializationFailure, internal.ErrCodeDeadlockDetected)
+}
+
+// repository executes queries against a pool or transaction
+type repository struct {
+	db querier
+}
 
 func (r repository) BatchQuery(ctx context.Context, query provider.BatchQuery) error {
 	queue := pgx.Batch{}
@@ -60,6 +85,51 @@ func (r repository) BatchQuery(ctx context.Context, query provider.BatchQuery) e
 	return nil
 }
 
+func (r repository) BatchWrite(ctx context.Context, batch provider.BatchWrite) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	queue := pgx.Batch{}
+	for _, item := range batch {
+		sql, args, err := batchWriteSql(item)
+		if err != nil {
+			return trail.Stacktrace(err)
+		}
+		queue.Queue(sql, args...)
+	}
+
+	res := r.db.SendBatch(ctx, &queue)
+	defer res.Close()
+
+	for i, item := range batch {
+		tag, err := res.Exec()
+		if err == nil {
+			item.Err, item.RowsAffected = nil, tag.RowsAffected()
+			continue
+		}
+
+		if internal.IsErrorCode(err, internal.ErrCodeUniqueViolation) {
+			err = ErrUnique
+		}
+
+		// the batch runs in a single transaction (the implicit one outside of a unit of work),
+		// so the writes before the failure are rolled back and the writes after it never run
+		item.Err, item.RowsAffected = err, 0
+		for _, prev := range batch[:i] {
+			prev.Err, prev.RowsAffected = ErrRolledBack, 0
+		}
+
+		for _, next := range batch[i+1:] {
+			next.Err, next.RowsAffected = ErrNotExecuted, 0
+		}
+
+		return trail.Stacktrace(err)
+	}
+
+	return nil
+}
+
 func (r repository) One(ctx context.Context, spec provider.Spec, v interface{}) error {
 	stmt, args, err := spec.ToSql()
 	if err != nil {
@@ -82,7 +152,8 @@ func (r repository) All(ctx context.Context, spec provider.Spec, v interface{})
 	return pgxscan.Select(ctx, r.db, v, stmt, args...)
 }
 
-func (r repository) Add(ctx context.Context, collection string, v interface{}) error {
+func (r repository) Add(ctx context.Context, collection string, v interface{}, opts ...provider.WriteOption) error {
+	conf := writeConfig(opts)
 	data, err := encode.Map(v)
 	if err != nil {
 		return trail.Stacktrace(err)
@@ -91,21 +162,83 @@ func (r repository) Add(ctx context.Context, collection string, v interface{}) e
 	builder := squirrel.StatementBuilder.
 		PlaceholderFormat(squirrel.Dollar).
 		Insert(collection).
-		SetMap(data)
+		SetMap(data).
+		Suffix(returning(conf))
 
 	stmt, args, err := builder.ToSql()
 	if err != nil {
 		return trail.Stacktrace(err)
 	}
 
-	if _, err = r.db.Exec(ctx, stmt, args...); internal.IsErrorCode(err, internal.ErrCodeUniqueViolation) {
+	if err = r.exec(ctx, conf, stmt, args...); internal.IsErrorCode(err, internal.ErrCodeUniqueViolation) {
+		err = ErrUnique
+	}
+
+	return trail.Stacktrace(err)
+}
+
+func (r repository) AddMany(ctx context.Context, collection string, v interface{}) error {
+	items, err := encode.Maps(v)
+	if err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	columns := make([]string, 0, len(items[0]))
+	for column := range items[0] {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	rows := make([][]interface{}, len(items))
+	for i, item := range items {
+		if len(item) != len(columns) {
+			return trail.NewErrorf("item %d does not match the columns of the first item", i)
+		}
+
+		rows[i] = make([]interface{}, len(columns))
+		for j, column := range columns {
+			value, present := item[column]
+			if !present {
+				return trail.NewErrorf("item %d is missing column %q", i, column)
+			}
+			rows[i][j] = value
+		}
+	}
+
+	if len(rows) >= copyThreshold {
+		_, err = r.db.CopyFrom(ctx, strings.Split(collection, "."), columns, pgx.CopyFromRows(rows))
+	} else {
+		builder := squirrel.StatementBuilder.
+			PlaceholderFormat(squirrel.Dollar).
+			Insert(collection).
+			Columns(columns...)
+
+		for _, row := range rows {
+			builder = builder.Values(row...)
+		}
+
+		var stmt string
+		var args []interface{}
+		if stmt, args, err = builder.ToSql(); err != nil {
+			return trail.Stacktrace(err)
+		}
+
+		_, err = r.db.Exec(ctx, stmt, args...)
+	}
+
+	if internal.IsErrorCode(err, internal.ErrCodeUniqueViolation) {
 		err = ErrUnique
 	}
 
 	return trail.Stacktrace(err)
 }
 
-func (r repository) Edit(ctx context.Context, collection string, spec provider.Spec, v interface{}) error {
+func (r repository) Edit(ctx context.Context, collection string, spec provider.Spec, v interface{}, opts ...provider.WriteOption) error {
+	conf := writeConfig(opts)
 	data, err := encode.Map(v)
 	if err != nil {
 		return trail.Stacktrace(err)
@@ -114,34 +247,326 @@ func (r repository) Edit(ctx context.Context, collection string, spec provider.S
 	builder := squirrel.StatementBuilder.
 		PlaceholderFormat(squirrel.Dollar).
 		Update(collection).
+		Where(spec)
+
+	// versioned values are only written if the version has not changed since they were read
+	name, version, versioned := encode.Version(v)
+	if versioned {
+		delete(data, name)
+		builder = builder.
+			Where(squirrel.Eq{name: version.Interface()}).
+			Set(name, squirrel.Expr(fmt.Sprintf("%s + 1", pgx.Identifier{name}.Sanitize())))
+
+		// the version is read back unless the returned rows are scanned into another value
+		if conf.Returning == nil && version.CanAddr() {
+			conf.Returning = version.Addr().Interface()
+			conf.ReturningColumns = []string{name}
+		}
+
+		if conf.RowsAffected == nil {
+			conf.RowsAffected = new(int64)
+		}
+	}
+
+	builder = builder.
+		SetMap(data).
+		Suffix(returning(conf))
+
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	err = r.exec(ctx, conf, stmt, args...)
+	if internal.IsErrorCode(err, internal.ErrCodeUniqueViolation) {
+		err = ErrUnique
+	}
+
+	if versioned && (err == ErrNotFound || err == nil && *conf.RowsAffected == 0) {
+		err = r.conflict(ctx, collection, spec)
+	}
+
+	if versioned && err == nil && !readsVersion(conf, v, name, version) {
+		increment(version)
+	}
+
+	return trail.Stacktrace(err)
+}
+
+// conflict checks whether a versioned write matched no rows because the row changed or does not exist
+func (r repository) conflict(ctx context.Context, collection string, spec provider.Spec) error {
+	builder := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Select("1").
+		From(collection).
 		Where(spec).
-		SetMap(data)
+		Prefix("SELECT EXISTS (").
+		Suffix(")")
 
 	stmt, args, err := builder.ToSql()
 	if err != nil {
 		return trail.Stacktrace(err)
 	}
 
-	if _, err = r.db.Exec(ctx, stmt, args...); internal.IsErrorCode(err, internal.ErrCodeUniqueViolation) {
+	var exists bool
+	if err := pgxscan.Get(ctx, r.db, &exists, stmt, args...); err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	if exists {
+		return ErrConflict
+	}
+
+	return ErrNotFound
+}
+
+func (r repository) Upsert(ctx context.Context, collection string, v interface{}, conflictColumns, updateColumns []string, opts ...provider.WriteOption) error {
+	conf := writeConfig(opts)
+	data, err := encode.Map(v)
+	if err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	if len(updateColumns) > 0 && len(conflictColumns) == 0 {
+		return trail.NewError("conflict columns are required to update on conflict")
+	}
+
+	conflict := "ON CONFLICT"
+	if len(conflictColumns) > 0 {
+		conflict = fmt.Sprintf("%s (%s)", conflict, identifiers(conflictColumns))
+	}
+
+	// versioned values are only updated if the version has not changed since they were read
+	name, version, versioned := encode.Version(v)
+	versioned = versioned && len(updateColumns) > 0
+
+	action := "DO NOTHING"
+	if len(updateColumns) > 0 {
+		assignments := make([]string, 0, len(updateColumns)+1)
+		for _, column := range updateColumns {
+			if versioned && column == name {
+				continue
+			}
+
+			ident := pgx.Identifier{column}.Sanitize()
+			assignments = append(assignments, fmt.Sprintf("%s = EXCLUDED.%s", ident, ident))
+		}
+
+		if versioned {
+			ident := pgx.Identifier{name}.Sanitize()
+			assignments = append(assignments, fmt.Sprintf("%s = %s.%s + 1", ident, collection, ident))
+		}
+
+		action = fmt.Sprintf("DO UPDATE SET %s", strings.Join(assignments, ", "))
+	}
+
+	if versioned {
+		column := pgx.Identifier{name}.Sanitize()
+		action = fmt.Sprintf("%s WHERE %s.%s = EXCLUDED.%s", action, collection, column, column)
+
+		// the version is read back as it is only incremented if the value is updated
+		// values whose returned rows are scanned into another value keep the version they were written with
+		if conf.Returning == nil && version.CanAddr() {
+			conf.Returning = version.Addr().Interface()
+			conf.ReturningColumns = []string{name}
+		}
+
+		if conf.RowsAffected == nil {
+			conf.RowsAffected = new(int64)
+		}
+	}
+
+	builder := squirrel.StatementBuilder.
+		PlaceholderFormat(squirrel.Dollar).
+		Insert(collection).
+		SetMap(data).
+		Suffix(fmt.Sprintf("%s %s", conflict, action)).
+		Suffix(returning(conf))
+
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	err = r.exec(ctx, conf, stmt, args...)
+	if internal.IsErrorCode(err, internal.ErrCodeUniqueViolation) {
 		err = ErrUnique
 	}
 
+	// a conflicting row exists if nothing was inserted or updated
+	if versioned && err == nil && *conf.RowsAffected == 0 {
+		err = ErrConflict
+	}
+
 	return trail.Stacktrace(err)
 }
 
-func (r repository) Remove(ctx context.Context, collection string, spec provider.Spec) error {
+func (r repository) Remove(ctx context.Context, collection string, spec provider.Spec, opts ...provider.WriteOption) error {
+	conf := writeConfig(opts)
 	builder := squirrel.StatementBuilder.
 		PlaceholderFormat(squirrel.Dollar).
 		Delete(collection).
-		Where(spec)
+		Where(spec).
+		Suffix(returning(conf))
 
 	stmt, args, err := builder.ToSql()
 	if err != nil {
 		return trail.Stacktrace(err)
 	}
 
-	_, err = r.db.Exec(ctx, stmt, args...)
-	return trail.Stacktrace(err)
+	return trail.Stacktrace(r.exec(ctx, conf, stmt, args...))
+}
+
+// exec executes a write statement, scans any returned rows and checks the rows affected
+func (r repository) exec(ctx context.Context, conf provider.WriteConfig, stmt string, args ...interface{}) error {
+	var affected int64
+	if conf.Returning == nil {
+		tag, err := r.db.Exec(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+
+		affected = tag.RowsAffected()
+	} else {
+		rows, err := r.db.Query(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+
+		if rv := reflect.ValueOf(conf.Returning); rv.Kind() != reflect.Ptr || rv.Elem().Kind() == reflect.Slice {
+			err = pgxscan.ScanAll(conf.Returning, rows)
+		} else {
+			// single value destinations hold the first row written and are untouched if none are
+			dst := reflect.New(reflect.SliceOf(rv.Elem().Type()))
+			if err = pgxscan.ScanAll(dst.Interface(), rows); err == nil && dst.Elem().Len() > 0 {
+				rv.Elem().Set(dst.Elem().Index(0))
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		affected = rows.CommandTag().RowsAffected()
+	}
+
+	if conf.RowsAffected != nil {
+		*conf.RowsAffected = affected
+	}
+
+	if conf.MustMatch && affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// writeConfig applies the write options
+func writeConfig(opts []provider.WriteOption) provider.WriteConfig {
+	conf := provider.WriteConfig{}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	return conf
+}
+
+// returning the RETURNING clause for the write config
+func returning(conf provider.WriteConfig) string {
+	if conf.Returning == nil {
+		return ""
+	}
+
+	if len(conf.ReturningColumns) == 0 {
+		return "RETURNING *"
+	}
+
+	return fmt.Sprintf("RETURNING %s", identifiers(conf.ReturningColumns))
+}
+
+// batchWriteSql converts a batch write item to sql
+func batchWriteSql(item *provider.BatchWriteItem) (string, []interface{}, error) {
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+	switch item.Kind {
+	case provider.BatchAdd:
+		data, err := encode.Map(item.Value)
+		if err != nil {
+			return "", nil, trail.Stacktrace(err)
+		}
+
+		return builder.Insert(item.Collection).SetMap(data).ToSql()
+	case provider.BatchEdit:
+		if _, _, versioned := encode.Version(item.Value); versioned {
+			return "", nil, trail.NewError("versioned values can not be edited in a batch")
+		}
+
+		data, err := encode.Map(item.Value)
+		if err != nil {
+			return "", nil, trail.Stacktrace(err)
+		}
+
+		return builder.Update(item.Collection).Where(item.Spec).SetMap(data).ToSql()
+	case provider.BatchRemove:
+		return builder.Delete(item.Collection).Where(item.Spec).ToSql()
+	}
+
+	return "", nil, trail.NewErrorf("unknown batch write kind %d", item.Kind)
+}
+
+// querier is the subset of pgx shared by pools and transactions
+type querier interface {
+	pgxscan.Querier
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// increment increments an integer version
+func increment(v reflect.Value) {
+	if !v.CanSet() {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(v.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(v.Uint() + 1)
+	}
+}
+
+// readsVersion checks if the version of a value is scanned from the returned rows
+func readsVersion(conf provider.WriteConfig, v interface{}, name string, version reflect.Value) bool {
+	if version.CanAddr() && conf.Returning == version.Addr().Interface() {
+		return true
+	}
+
+	if reflect.ValueOf(v).Kind() != reflect.Ptr || conf.Returning != v {
+		return false
+	}
+
+	return len(conf.ReturningColumns) == 0 || contains(conf.ReturningColumns, name)
+}
+
+// contains checks if the column is in the list of columns
+func contains(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+// identifiers sanitizes and joins column names
+func identifiers(columns []string) string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = pgx.Identifier{column}.Sanitize()
+	}
+
+	return strings.Join(names, ", ")
 }
 
 type batchResults struct {
@@ -2,8 +2,10 @@ package pg
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
+	"github.com/jackc/pgconn"
 	"github.com/pghq/go-tea/trail"
 	"github.com/stretchr/testify/assert"
 
@@ -32,6 +34,73 @@ func TestRepository_Add(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.True(t, trail.IsConflict(err))
 	})
+
+	t.Run("returning", func(t *testing.T) {
+		var v struct {
+			Id   string
+			Name *string
+		}
+		assert.Nil(t, repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "add.returning:1234"}, provider.WithReturning(&v)))
+		assert.Equal(t, "add.returning:1234", v.Id)
+		assert.Nil(t, v.Name)
+	})
+
+	t.Run("returning unique violation error", func(t *testing.T) {
+		var v struct{ Id string }
+		err := repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "1234"}, provider.WithReturning(&v, "id"))
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsConflict(err))
+	})
+}
+
+func TestRepository_AddMany(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	repo := db.Repository()
+	t.Run("bad data encode", func(t *testing.T) {
+		assert.NotNil(t, repo.AddMany(context.TODO(), "tests", map[string]interface{}{"id": "add.many:1234"}))
+	})
+
+	t.Run("mismatched columns", func(t *testing.T) {
+		items := []map[string]interface{}{{"id": "add.many:1234"}, {"name": "foo"}}
+		assert.NotNil(t, repo.AddMany(context.TODO(), "tests", items))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		assert.Nil(t, repo.AddMany(context.TODO(), "tests", []map[string]interface{}{}))
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		type item struct {
+			Id   string `db:"id"`
+			Name string `db:"name"`
+		}
+
+		items := []item{{Id: "add.many:1234", Name: "foo"}, {Id: "add.many:12345", Name: "bar"}}
+		assert.Nil(t, repo.AddMany(context.TODO(), "tests", items))
+
+		err := repo.AddMany(context.TODO(), "tests", items)
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsConflict(err))
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		var items []map[string]interface{}
+		for i := 0; i < copyThreshold; i++ {
+			items = append(items, map[string]interface{}{"id": fmt.Sprintf("add.many.copy:%d", i), "num": i})
+		}
+
+		assert.Nil(t, repo.AddMany(context.TODO(), "tests", items))
+
+		var v []struct{ Id string }
+		assert.Nil(t, repo.All(context.TODO(), spec("SELECT id FROM tests WHERE id LIKE 'add.many.copy:%'"), &v))
+		assert.Len(t, v, copyThreshold)
+
+		err := repo.AddMany(context.TODO(), "tests", items)
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsConflict(err))
+	})
 }
 
 func TestRepository_All(t *testing.T) {
@@ -85,6 +154,67 @@ func TestRepository_BatchQuery(t *testing.T) {
 	})
 }
 
+func TestRepository_BatchWrite(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	repo := db.Repository()
+	t.Run("empty", func(t *testing.T) {
+		assert.Nil(t, repo.BatchWrite(context.TODO(), provider.BatchWrite{}))
+	})
+
+	t.Run("bad data encode", func(t *testing.T) {
+		batch := provider.BatchWrite{}
+		batch.Add("tests", func() {})
+		assert.NotNil(t, repo.BatchWrite(context.TODO(), batch))
+	})
+
+	t.Run("versioned edit", func(t *testing.T) {
+		batch := provider.BatchWrite{}
+		batch.Edit("tests", spec("id = 'batch.write:1234'"), &struct {
+			Version int `db:"num,version"`
+		}{})
+		assert.NotNil(t, repo.BatchWrite(context.TODO(), batch))
+	})
+
+	t.Run("bad sql", func(t *testing.T) {
+		batch := provider.BatchWrite{}
+		batch.Remove("", spec(""))
+		assert.NotNil(t, repo.BatchWrite(context.TODO(), batch))
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		batch := provider.BatchWrite{}
+		add := batch.Add("tests", map[string]interface{}{"id": "batch.write:1234"})
+		edit := batch.Edit("tests", spec("id = 'batch.write:1234'"), map[string]interface{}{"name": "foo"})
+		remove := batch.Remove("tests", spec("id = 'batch.write:foo'"))
+		assert.Nil(t, repo.BatchWrite(context.TODO(), batch))
+		assert.Equal(t, int64(1), add.RowsAffected)
+		assert.Equal(t, int64(1), edit.RowsAffected)
+		assert.Equal(t, int64(0), remove.RowsAffected)
+	})
+
+	t.Run("unique violation error", func(t *testing.T) {
+		batch := provider.BatchWrite{}
+		first := batch.Add("tests", map[string]interface{}{"id": "batch.write:12345"})
+		failed := batch.Add("tests", map[string]interface{}{"id": "batch.write:1234"})
+		last := batch.Add("tests", map[string]interface{}{"id": "batch.write:123456"})
+		err := repo.BatchWrite(context.TODO(), batch)
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsConflict(err))
+
+		assert.Equal(t, ErrRolledBack, first.Err)
+		assert.Equal(t, int64(0), first.RowsAffected)
+		assert.True(t, trail.IsConflict(failed.Err))
+		assert.Equal(t, ErrNotExecuted, last.Err)
+		assert.Equal(t, int64(0), last.RowsAffected)
+
+		var v []struct{ Id string }
+		assert.Nil(t, repo.All(context.TODO(), spec("SELECT id FROM tests WHERE id IN ('batch.write:12345', 'batch.write:123456')"), &v))
+		assert.Empty(t, v)
+	})
+}
+
 func TestRepository_Edit(t *testing.T) {
 	trail.Testing()
 	t.Parallel()
@@ -107,6 +237,98 @@ func TestRepository_Edit(t *testing.T) {
 		assert.Nil(t, repo.Edit(context.TODO(), "tests", spec("id = 'edit:1234'"), map[string]interface{}{"id": "edit:1234"}))
 	})
 
+	t.Run("returning", func(t *testing.T) {
+		var v []struct{ Name string }
+		assert.Nil(t, repo.Edit(context.TODO(), "tests", spec("id = 'edit:1234'"), map[string]interface{}{"name": "foo"}, provider.WithReturning(&v, "name")))
+		assert.Equal(t, []struct{ Name string }{{Name: "foo"}}, v)
+	})
+
+	t.Run("rows affected", func(t *testing.T) {
+		var n int64
+		assert.Nil(t, repo.Edit(context.TODO(), "tests", spec("id = 'edit:1234'"), map[string]interface{}{"name": "foo"}, provider.WithRowsAffected(&n)))
+		assert.Equal(t, int64(1), n)
+	})
+
+	t.Run("must match", func(t *testing.T) {
+		var n int64
+		err := repo.Edit(context.TODO(), "tests", spec("id = 'edit:foo'"), map[string]interface{}{"name": "foo"}, provider.WithRowsAffected(&n), provider.WithMustMatch())
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsNotFound(err))
+		assert.Equal(t, int64(0), n)
+	})
+
+	t.Run("versioned", func(t *testing.T) {
+		type item struct {
+			Name    string `db:"name"`
+			Version int    `db:"num,version"`
+		}
+
+		_ = repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "edit.version:1234", "num": 1})
+		v := item{Name: "foo", Version: 1}
+		assert.Nil(t, repo.Edit(context.TODO(), "tests", spec("id = 'edit.version:1234'"), &v))
+		assert.Equal(t, 2, v.Version)
+
+		stale := item{Name: "bar", Version: 1}
+		err := repo.Edit(context.TODO(), "tests", spec("id = 'edit.version:1234'"), &stale)
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsConflict(err))
+		assert.Equal(t, 1, stale.Version)
+
+		var current item
+		assert.Nil(t, repo.One(context.TODO(), spec("SELECT name, num FROM tests WHERE id = 'edit.version:1234'"), &current))
+		assert.Equal(t, v, current)
+	})
+
+	t.Run("versioned returning", func(t *testing.T) {
+		type item struct {
+			Name    string `db:"name"`
+			Version int    `db:"num,version"`
+		}
+
+		_ = repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "edit.version:12345", "num": 1})
+		v := item{Name: "foo", Version: 1}
+		assert.Nil(t, repo.Edit(context.TODO(), "tests", spec("id = 'edit.version:12345'"), &v, provider.WithReturning(&v, "name", "num")))
+		assert.Equal(t, 2, v.Version)
+
+		var returned item
+		assert.Nil(t, repo.Edit(context.TODO(), "tests", spec("id = 'edit.version:12345'"), &v, provider.WithReturning(&returned, "name", "num")))
+		assert.Equal(t, 3, returned.Version)
+		assert.Equal(t, 3, v.Version)
+	})
+
+	t.Run("versioned not found", func(t *testing.T) {
+		v := struct {
+			Version int `db:"num,version"`
+		}{}
+		err := repo.Edit(context.TODO(), "tests", spec("id = 'edit.version:foo'"), &v)
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsNotFound(err))
+	})
+
+	t.Run("returning no match", func(t *testing.T) {
+		v := struct{ Name string }{Name: "bar"}
+		assert.Nil(t, repo.Edit(context.TODO(), "tests", spec("id = 'edit:foo'"), map[string]interface{}{"name": "foo"}, provider.WithReturning(&v, "name")))
+		assert.Equal(t, "bar", v.Name)
+	})
+
+	t.Run("returning many rows into one value", func(t *testing.T) {
+		_ = repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "edit.many:1234"})
+		_ = repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "edit.many:12345"})
+
+		var v struct{ Id string }
+		var n int64
+		assert.Nil(t, repo.Edit(context.TODO(), "tests", spec("id LIKE 'edit.many:%'"), map[string]interface{}{"name": "foo"}, provider.WithReturning(&v, "id"), provider.WithRowsAffected(&n)))
+		assert.Contains(t, v.Id, "edit.many:")
+		assert.Equal(t, int64(2), n)
+	})
+
+	t.Run("returning must match", func(t *testing.T) {
+		var v struct{ Name string }
+		err := repo.Edit(context.TODO(), "tests", spec("id = 'edit:foo'"), map[string]interface{}{"name": "foo"}, provider.WithReturning(&v, "name"), provider.WithMustMatch())
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsNotFound(err))
+	})
+
 	t.Run("unique violation error", func(t *testing.T) {
 		_ = repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "edit:12345"})
 		err := repo.Edit(context.TODO(), "tests", spec("id = 'edit:12345'"), map[string]interface{}{"id": "edit:1234"})
@@ -115,6 +337,109 @@ func TestRepository_Edit(t *testing.T) {
 	})
 }
 
+func TestRepository_Upsert(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	repo := db.Repository()
+	_ = repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "upsert:1234", "name": "foo"})
+
+	t.Run("bad data encode", func(t *testing.T) {
+		assert.NotNil(t, repo.Upsert(context.TODO(), "tests", func() {}, nil, nil))
+	})
+
+	t.Run("bad sql", func(t *testing.T) {
+		assert.NotNil(t, repo.Upsert(context.TODO(), "", nil, nil, nil))
+	})
+
+	t.Run("missing conflict columns", func(t *testing.T) {
+		assert.NotNil(t, repo.Upsert(context.TODO(), "tests", map[string]interface{}{"id": "upsert:1234"}, nil, []string{"name"}))
+	})
+
+	t.Run("do nothing", func(t *testing.T) {
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", map[string]interface{}{"id": "upsert:1234", "name": "bar"}, []string{"id"}, nil))
+
+		var v struct{ Name string }
+		assert.Nil(t, repo.One(context.TODO(), spec("SELECT name FROM tests WHERE id = 'upsert:1234'"), &v))
+		assert.Equal(t, "foo", v.Name)
+	})
+
+	t.Run("do update", func(t *testing.T) {
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", map[string]interface{}{"id": "upsert:1234", "name": "bar"}, []string{"id"}, []string{"name"}))
+
+		var v struct{ Name string }
+		assert.Nil(t, repo.One(context.TODO(), spec("SELECT name FROM tests WHERE id = 'upsert:1234'"), &v))
+		assert.Equal(t, "bar", v.Name)
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", map[string]interface{}{"id": "upsert:12345"}, []string{"id"}, []string{"name"}))
+	})
+
+	t.Run("versioned", func(t *testing.T) {
+		type item struct {
+			Id      string `db:"id"`
+			Name    string `db:"name"`
+			Version int    `db:"num,version"`
+		}
+
+		v := item{Id: "upsert.version:1234", Name: "foo", Version: 1}
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", &v, []string{"id"}, []string{"name", "num"}))
+		assert.Equal(t, 1, v.Version)
+
+		v.Name = "bar"
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", &v, []string{"id"}, []string{"name", "num"}))
+		assert.Equal(t, 2, v.Version)
+
+		stale := item{Id: "upsert.version:1234", Name: "baz", Version: 1}
+		err := repo.Upsert(context.TODO(), "tests", &stale, []string{"id"}, []string{"name", "num"})
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsConflict(err))
+		assert.Equal(t, 1, stale.Version)
+
+		var current item
+		assert.Nil(t, repo.One(context.TODO(), spec("SELECT id, name, num FROM tests WHERE id = 'upsert.version:1234'"), &current))
+		assert.Equal(t, v, current)
+	})
+
+	t.Run("versioned without version column", func(t *testing.T) {
+		type item struct {
+			Id      string `db:"id"`
+			Name    string `db:"name"`
+			Version int    `db:"num,version"`
+		}
+
+		v := item{Id: "upsert.version:12345", Name: "foo", Version: 1}
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", &v, []string{"id"}, []string{"name"}))
+
+		v.Name = "bar"
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", &v, []string{"id"}, []string{"name"}))
+		assert.Equal(t, 2, v.Version)
+
+		stale := item{Id: "upsert.version:12345", Name: "baz", Version: 1}
+		err := repo.Upsert(context.TODO(), "tests", &stale, []string{"id"}, []string{"name"})
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsConflict(err))
+	})
+
+	t.Run("versioned returning", func(t *testing.T) {
+		type item struct {
+			Id      string `db:"id"`
+			Name    string `db:"name"`
+			Version int    `db:"num,version"`
+		}
+
+		v := item{Id: "upsert.version:123456", Name: "foo", Version: 1}
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", &v, []string{"id"}, []string{"name", "num"}))
+
+		var returned item
+		v.Name = "bar"
+		assert.Nil(t, repo.Upsert(context.TODO(), "tests", &v, []string{"id"}, []string{"name", "num"}, provider.WithReturning(&returned, "id", "name", "num")))
+		assert.Equal(t, 2, returned.Version)
+		assert.Equal(t, 1, v.Version)
+	})
+}
+
 func TestRepository_One(t *testing.T) {
 	trail.Testing()
 	t.Parallel()
@@ -152,6 +477,36 @@ func TestRepository_Remove(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		assert.Nil(t, repo.Remove(context.TODO(), "tests", spec("id = 'remove:1234'")))
 	})
+
+	t.Run("must match", func(t *testing.T) {
+		err := repo.Remove(context.TODO(), "tests", spec("id = 'remove:1234'"), provider.WithMustMatch())
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsNotFound(err))
+	})
+
+	t.Run("returning", func(t *testing.T) {
+		_ = repo.Add(context.TODO(), "tests", map[string]interface{}{"id": "remove.returning:1234"})
+		var v struct{ Id string }
+		assert.Nil(t, repo.Remove(context.TODO(), "tests", spec("id = 'remove.returning:1234'"), provider.WithReturning(&v, "id")))
+		assert.Equal(t, "remove.returning:1234", v.Id)
+	})
+}
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	t.Run("serialization failure", func(t *testing.T) {
+		assert.True(t, IsRetryable(trail.Stacktrace(&pgconn.PgError{Code: "40001"})))
+	})
+
+	t.Run("deadlock", func(t *testing.T) {
+		assert.True(t, IsRetryable(&pgconn.PgError{Code: "40P01"}))
+	})
+
+	t.Run("other", func(t *testing.T) {
+		assert.False(t, IsRetryable(ErrUnique))
+		assert.False(t, IsRetryable(&pgconn.PgError{Code: "23505"}))
+	})
 }
 
 type spec string
@@ -2,8 +2,13 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/pghq/go-tea/trail"
+
+	"github.com/pghq/go-store/internal/key"
 )
 
 var _ Spec = spec{}
@@ -14,8 +19,16 @@ type Provider interface {
 	Begin(ctx context.Context, opts ...TxOption) (UnitOfWork, error)
 }
 
+// Notifier broadcasts messages to every instance listening on a channel
+type Notifier interface {
+	Notify(ctx context.Context, channel, payload string) error
+	Listen(ctx context.Context, channel string, fn func(payload string)) error
+}
+
 // UnitOfWork to do
 type UnitOfWork interface {
+	Repository() Repository
+	Savepoint(ctx context.Context) (UnitOfWork, error)
 	Commit(ctx context.Context) error
 	Rollback(ctx context.Context)
 }
@@ -24,10 +37,13 @@ type UnitOfWork interface {
 type Repository interface {
 	One(ctx context.Context, spec Spec, v interface{}) error
 	All(ctx context.Context, spec Spec, v interface{}) error
-	Add(ctx context.Context, collection string, v interface{}) error
-	Edit(ctx context.Context, collection string, spec Spec, v interface{}) error
-	Remove(ctx context.Context, collection string, spec Spec) error
+	Add(ctx context.Context, collection string, v interface{}, opts ...WriteOption) error
+	AddMany(ctx context.Context, collection string, v interface{}) error
+	Edit(ctx context.Context, collection string, spec Spec, v interface{}, opts ...WriteOption) error
+	Upsert(ctx context.Context, collection string, v interface{}, conflictColumns, updateColumns []string, opts ...WriteOption) error
+	Remove(ctx context.Context, collection string, spec Spec, opts ...WriteOption) error
 	BatchQuery(ctx context.Context, query BatchQuery) error
+	BatchWrite(ctx context.Context, batch BatchWrite) error
 }
 
 // Spec for querying objects
@@ -36,9 +52,57 @@ type Spec interface {
 	ToSql() (string, []interface{}, error)
 }
 
+// IsolationLevel the isolation level of a transaction
+type IsolationLevel string
+
+const (
+	// Serializable emulates serial transaction execution
+	Serializable IsolationLevel = "serializable"
+
+	// RepeatableRead sees only data committed before the transaction began
+	RepeatableRead IsolationLevel = "repeatable read"
+
+	// ReadCommitted sees only data committed before each statement began
+	ReadCommitted IsolationLevel = "read committed"
+)
+
+// RetryPolicy a policy for re-running units of work that fail with transient errors
+// (e.g., serialization failures and deadlocks)
+type RetryPolicy struct {
+	// MaxAttempts the maximum number of attempts including the first (default 3)
+	MaxAttempts int
+
+	// MinBackoff the base delay between attempts (default 10ms)
+	MinBackoff time.Duration
+
+	// MaxBackoff the maximum delay between attempts (default 1s)
+	MaxBackoff time.Duration
+
+	// OnRetry is called with the failed attempt number and error before each retry
+	OnRetry func(attempt int, err error)
+}
+
 // TxConfig a configuration for transactions
 type TxConfig struct {
-	ReadOnly bool
+	ReadOnly   bool
+	Isolation  IsolationLevel
+	Deferrable bool
+	Retry      *RetryPolicy
+}
+
+// Validate checks the configuration for unsupported combinations
+func (c TxConfig) Validate() error {
+	switch c.Isolation {
+	case "", Serializable, RepeatableRead, ReadCommitted:
+	default:
+		return trail.NewErrorf("unknown isolation level %q", c.Isolation)
+	}
+
+	if c.Deferrable && (c.Isolation != Serializable || !c.ReadOnly) {
+		return trail.NewError("deferrable transactions must be serializable and read-only")
+	}
+
+	return nil
 }
 
 // TxOption a configuration option for transactions
@@ -51,6 +115,61 @@ func WithReadOnly(flag bool) TxOption {
 	}
 }
 
+// WithIsolation use a custom isolation level
+func WithIsolation(level IsolationLevel) TxOption {
+	return func(conf *TxConfig) {
+		conf.Isolation = level
+	}
+}
+
+// WithRetry retry the unit of work on transient errors
+func WithRetry(policy RetryPolicy) TxOption {
+	return func(conf *TxConfig) {
+		conf.Retry = &policy
+	}
+}
+
+// WithDeferrable use a deferrable transaction (requires serializable and read-only)
+func WithDeferrable(flag bool) TxOption {
+	return func(conf *TxConfig) {
+		conf.Deferrable = flag
+	}
+}
+
+// WriteConfig a configuration for write ops
+type WriteConfig struct {
+	Returning        interface{}
+	ReturningColumns []string
+	RowsAffected     *int64
+	MustMatch        bool
+}
+
+// WriteOption a configuration option for write ops
+type WriteOption func(conf *WriteConfig)
+
+// WithReturning scan the columns of the written rows into v (all columns if none are specified)
+// v is a pointer to a slice for all rows or a pointer to a struct for the first
+func WithReturning(v interface{}, columns ...string) WriteOption {
+	return func(conf *WriteConfig) {
+		conf.Returning = v
+		conf.ReturningColumns = columns
+	}
+}
+
+// WithRowsAffected store the number of rows written in n
+func WithRowsAffected(n *int64) WriteOption {
+	return func(conf *WriteConfig) {
+		conf.RowsAffected = n
+	}
+}
+
+// WithMustMatch fail with a not found error if no rows are written
+func WithMustMatch() WriteOption {
+	return func(conf *WriteConfig) {
+		conf.MustMatch = true
+	}
+}
+
 type spec struct {
 	id      interface{}
 	sqlizer squirrel.Sqlizer
@@ -64,6 +183,82 @@ func (s spec) ToSql() (string, []interface{}, error) {
 	return s.sqlizer.ToSql()
 }
 
+// CountSpec a spec counting the results of a spec
+type CountSpec struct {
+	Spec
+}
+
+func (s CountSpec) Id() interface{} {
+	return key.Derive("count", s.Spec.Id())
+}
+
+func (s CountSpec) ToSql() (string, []interface{}, error) {
+	sql, args, err := s.Spec.ToSql()
+	if err != nil {
+		return "", nil, trail.Stacktrace(err)
+	}
+
+	return fmt.Sprintf("SELECT count(*) FROM (%s) AS t", sql), args, nil
+}
+
+// ExistsSpec a spec checking if a spec has any results
+type ExistsSpec struct {
+	Spec
+}
+
+func (s ExistsSpec) Id() interface{} {
+	return key.Derive("exists", s.Spec.Id())
+}
+
+func (s ExistsSpec) ToSql() (string, []interface{}, error) {
+	sql, args, err := s.Spec.ToSql()
+	if err != nil {
+		return "", nil, trail.Stacktrace(err)
+	}
+
+	return fmt.Sprintf("SELECT EXISTS (%s)", sql), args, nil
+}
+
+// SelectSpec a spec selecting from collections that can be narrowed with additional conditions
+type SelectSpec interface {
+	Spec
+	Collections() []string
+	Where(pred interface{}, args ...interface{}) SelectSpec
+}
+
+type selectSpec struct {
+	id          interface{}
+	builder     squirrel.SelectBuilder
+	collections []string
+}
+
+func (s selectSpec) Id() interface{} {
+	return s.id
+}
+
+func (s selectSpec) ToSql() (string, []interface{}, error) {
+	return s.builder.ToSql()
+}
+
+func (s selectSpec) Collections() []string {
+	return s.collections
+}
+
+func (s selectSpec) Where(pred interface{}, args ...interface{}) SelectSpec {
+	s.builder = s.builder.Where(pred, args...)
+	return s
+}
+
+// NewSelectSpec is a helper for creating a spec selecting from the collections
+// the collections are referenced by name in conditions added to the spec, so they should not be aliased
+func NewSelectSpec(id interface{}, builder squirrel.SelectBuilder, collections ...string) SelectSpec {
+	return selectSpec{
+		id:          id,
+		builder:     builder,
+		collections: collections,
+	}
+}
+
 // NewSpec is a helper for creating a spec
 func NewSpec(id interface{}, sqlizer squirrel.Sqlizer) Spec {
 	return spec{
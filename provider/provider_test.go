@@ -6,6 +6,8 @@ import (
 	"github.com/Masterminds/squirrel"
 	"github.com/pghq/go-tea/trail"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/pghq/go-store/internal/key"
 )
 
 func TestWithReadOnly(t *testing.T) {
@@ -19,6 +21,99 @@ func TestWithReadOnly(t *testing.T) {
 	})
 }
 
+func TestWithIsolation(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		conf := TxConfig{}
+		WithIsolation(Serializable)(&conf)
+		assert.Equal(t, Serializable, conf.Isolation)
+	})
+}
+
+func TestWithDeferrable(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		conf := TxConfig{}
+		WithDeferrable(true)(&conf)
+		assert.True(t, conf.Deferrable)
+	})
+}
+
+func TestWithRetry(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		conf := TxConfig{}
+		WithRetry(RetryPolicy{MaxAttempts: 5})(&conf)
+		assert.NotNil(t, conf.Retry)
+		assert.Equal(t, 5, conf.Retry.MaxAttempts)
+	})
+}
+
+func TestWithReturning(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		var v struct{ Id string }
+		conf := WriteConfig{}
+		WithReturning(&v, "id")(&conf)
+		assert.Equal(t, &v, conf.Returning)
+		assert.Equal(t, []string{"id"}, conf.ReturningColumns)
+	})
+}
+
+func TestWithRowsAffected(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		var n int64
+		conf := WriteConfig{}
+		WithRowsAffected(&n)(&conf)
+		assert.Equal(t, &n, conf.RowsAffected)
+	})
+}
+
+func TestWithMustMatch(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		conf := WriteConfig{}
+		WithMustMatch()(&conf)
+		assert.True(t, conf.MustMatch)
+	})
+}
+
+func TestTxConfig_Validate(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("unknown isolation level", func(t *testing.T) {
+		assert.NotNil(t, TxConfig{Isolation: "chaos"}.Validate())
+	})
+
+	t.Run("deferrable without serializable", func(t *testing.T) {
+		assert.NotNil(t, TxConfig{ReadOnly: true, Isolation: RepeatableRead, Deferrable: true}.Validate())
+	})
+
+	t.Run("deferrable without read-only", func(t *testing.T) {
+		assert.NotNil(t, TxConfig{Isolation: Serializable, Deferrable: true}.Validate())
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		assert.Nil(t, TxConfig{}.Validate())
+		assert.Nil(t, TxConfig{Isolation: ReadCommitted}.Validate())
+		assert.Nil(t, TxConfig{ReadOnly: true, Isolation: Serializable, Deferrable: true}.Validate())
+	})
+}
+
 func TestNewSpec(t *testing.T) {
 	trail.Testing()
 	t.Parallel()
@@ -31,3 +126,62 @@ func TestNewSpec(t *testing.T) {
 		assert.Nil(t, err)
 	})
 }
+
+func TestCountSpec(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("bad spec", func(t *testing.T) {
+		spec := CountSpec{Spec: NewSpec("spec", squirrel.Select())}
+		_, _, err := spec.ToSql()
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		spec := CountSpec{Spec: NewSpec("spec", squirrel.Expr("SELECT * from specs WHERE id = ?", 1))}
+		assert.Equal(t, key.Derive("count", "spec"), spec.Id())
+		sql, args, err := spec.ToSql()
+		assert.Nil(t, err)
+		assert.Equal(t, "SELECT count(*) FROM (SELECT * from specs WHERE id = ?) AS t", sql)
+		assert.Equal(t, []interface{}{1}, args)
+	})
+}
+
+func TestExistsSpec(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("bad spec", func(t *testing.T) {
+		spec := ExistsSpec{Spec: NewSpec("spec", squirrel.Select())}
+		_, _, err := spec.ToSql()
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		spec := ExistsSpec{Spec: NewSpec("spec", squirrel.Expr("SELECT * from specs"))}
+		assert.Equal(t, key.Derive("exists", "spec"), spec.Id())
+		sql, _, err := spec.ToSql()
+		assert.Nil(t, err)
+		assert.Equal(t, "SELECT EXISTS (SELECT * from specs)", sql)
+	})
+}
+
+func TestNewSelectSpec(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		builder := squirrel.Select("id").From("specs").Where("id = ?", 1).Limit(1)
+		spec := NewSelectSpec("spec", builder, "specs")
+		assert.Equal(t, "spec", spec.Id())
+		assert.Equal(t, []string{"specs"}, spec.Collections())
+
+		sql, args, err := spec.Where("specs.deleted_at IS NULL").ToSql()
+		assert.Nil(t, err)
+		assert.Equal(t, "SELECT id FROM specs WHERE id = ? AND specs.deleted_at IS NULL LIMIT 1", sql)
+		assert.Equal(t, []interface{}{1}, args)
+
+		sql, _, _ = spec.ToSql()
+		assert.Equal(t, "SELECT id FROM specs WHERE id = ? LIMIT 1", sql)
+	})
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/pghq/go-tea/trail"
+
+	"github.com/pghq/go-store/internal/key"
+	"github.com/pghq/go-store/provider"
+)
+
+// deletedAt the column holding the time values of soft delete collections were removed
+const deletedAt = "deleted_at"
+
+// Restore restores soft deleted value(s) in the collection
+func (s Store) Restore(ctx context.Context, collection string, spec provider.Spec, opts ...provider.WriteOption) error {
+	span := trail.StartSpan(ctx, "Store.Restore")
+	defer span.Finish()
+
+	if !s.softDeleted(collection) {
+		return trail.NewErrorf("collection %q does not use soft delete", collection)
+	}
+
+	data := map[string]interface{}{deletedAt: nil}
+	err := s.repository(ctx).Edit(ctx, collection, deleted(spec), data, opts...)
+	s.invalidate(ctx, invalidation{Collections: []string{collection}, Keys: []interface{}{spec.Id()}})
+	return trail.Stacktrace(err)
+}
+
+// Purge permanently deletes soft deleted value(s) in the collection
+func (s Store) Purge(ctx context.Context, collection string, spec provider.Spec, opts ...provider.WriteOption) error {
+	span := trail.StartSpan(ctx, "Store.Purge")
+	defer span.Finish()
+
+	if !s.softDeleted(collection) {
+		return trail.NewErrorf("collection %q does not use soft delete", collection)
+	}
+
+	err := s.repository(ctx).Remove(ctx, collection, deleted(spec), opts...)
+	s.invalidate(ctx, invalidation{Collections: []string{collection}, Keys: []interface{}{spec.Id()}})
+	return trail.Stacktrace(err)
+}
+
+// Restore restores soft deleted value(s) in the collection
+func (tx Txn) Restore(collection string, spec provider.Spec, opts ...provider.WriteOption) error {
+	return tx.store.Restore(tx.Context(), collection, spec, opts...)
+}
+
+// Purge permanently deletes soft deleted value(s) in the collection
+func (tx Txn) Purge(collection string, spec provider.Spec, opts ...provider.WriteOption) error {
+	return tx.store.Purge(tx.Context(), collection, spec, opts...)
+}
+
+// contains checks if the collection is in the list of collections
+func contains(collections []string, collection string) bool {
+	for _, c := range collections {
+		if c == collection {
+			return true
+		}
+	}
+
+	return false
+}
+
+// softDeleted checks if any of the collections use soft delete
+func (s Store) softDeleted(collections ...string) bool {
+	for _, collection := range collections {
+		if _, present := s.softDelete[collection]; present {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scope excludes soft deleted rows from reads of soft delete collections unless they are requested
+// the collections read are those of select specs and those the query is tagged with
+func (s Store) scope(spec provider.Spec, conf QueryConfig) (provider.Spec, error) {
+	switch spec := spec.(type) {
+	case provider.CountSpec:
+		inner, err := s.scope(spec.Spec, conf)
+		return provider.CountSpec{Spec: inner}, err
+	case provider.ExistsSpec:
+		inner, err := s.scope(spec.Spec, conf)
+		return provider.ExistsSpec{Spec: inner}, err
+	}
+
+	collections := append([]string{}, conf.Collections...)
+	sel, ok := spec.(provider.SelectSpec)
+	if ok {
+		collections = append(collections, sel.Collections()...)
+	}
+
+	var scoped []string
+	for _, collection := range collections {
+		if s.softDeleted(collection) && !contains(scoped, collection) {
+			scoped = append(scoped, collection)
+		}
+	}
+
+	if len(scoped) == 0 {
+		return spec, nil
+	}
+
+	if conf.Deleted {
+		return deletedSpec{spec}, nil
+	}
+
+	if !ok {
+		return nil, trail.NewErrorf("reads of soft delete collection %q require a select spec", scoped[0])
+	}
+
+	for _, collection := range scoped {
+		sel = sel.Where(fmt.Sprintf("%s.%s IS NULL", collection, deletedAt))
+	}
+
+	return sel, nil
+}
+
+// live matches the rows of a write spec that are not soft deleted
+func live(spec provider.Spec) provider.Spec {
+	return provider.NewSpec(spec.Id(), squirrel.And{spec, squirrel.Eq{deletedAt: nil}})
+}
+
+// deleted matches the rows of a write spec that are soft deleted
+func deleted(spec provider.Spec) provider.Spec {
+	return provider.NewSpec(spec.Id(), squirrel.And{spec, squirrel.NotEq{deletedAt: nil}})
+}
+
+// deletedSpec a read spec including soft deleted rows
+type deletedSpec struct {
+	provider.Spec
+}
+
+func (s deletedSpec) Id() interface{} {
+	return deletedKey(s.Spec.Id())
+}
+
+// deletedKey the cache key of reads including soft deleted rows
+func deletedKey(id interface{}) string {
+	return key.Derive("deleted", id)
+}
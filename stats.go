@@ -0,0 +1,104 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/ristretto"
+)
+
+// CacheStats statistics of the query cache
+type CacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	HitRatio float64
+
+	// Evictions and CostUsed are only reported by ristretto caches with metrics enabled
+	Evictions uint64
+	CostUsed  uint64
+
+	// Collections statistics of queries by the collections they read from
+	Collections map[string]CollectionCacheStats
+}
+
+// CollectionCacheStats statistics of the query cache for a collection
+type CollectionCacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	HitRatio float64
+}
+
+// CacheStats gets statistics of the query cache
+func (s Store) CacheStats() CacheStats {
+	stats := CacheStats{
+		Hits:        atomic.LoadUint64(&s.stats.hits),
+		Misses:      atomic.LoadUint64(&s.stats.misses),
+		Collections: make(map[string]CollectionCacheStats),
+	}
+
+	stats.HitRatio = ratio(stats.Hits, stats.Misses)
+	if c, ok := s.cache.(*ristretto.Cache); ok && c.Metrics != nil {
+		stats.Evictions = c.Metrics.KeysEvicted()
+		stats.CostUsed = c.Metrics.CostAdded() - c.Metrics.CostEvicted()
+	}
+
+	s.stats.lock.Lock()
+	defer s.stats.lock.Unlock()
+	for collection, counts := range s.stats.collections {
+		stats.Collections[collection] = CollectionCacheStats{
+			Hits:     counts[0],
+			Misses:   counts[1],
+			HitRatio: ratio(counts[0], counts[1]),
+		}
+	}
+
+	return stats
+}
+
+// cacheStats counts cache lookups
+type cacheStats struct {
+	hits        uint64
+	misses      uint64
+	lock        sync.Mutex
+	collections map[string][2]uint64
+}
+
+// record counts a cache lookup for a query reading from the collections
+func (c *cacheStats) record(collections []string, hit bool) {
+	if hit {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+
+	if len(collections) == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.collections == nil {
+		c.collections = make(map[string][2]uint64)
+	}
+
+	for _, collection := range collections {
+		counts := c.collections[collection]
+		if hit {
+			counts[0]++
+		} else {
+			counts[1]++
+		}
+
+		c.collections[collection] = counts
+	}
+}
+
+// ratio computes the ratio of hits to lookups
+func ratio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(hits+misses)
+}
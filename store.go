@@ -16,13 +16,18 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"math/rand"
 	"os"
 	"reflect"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/dgraph-io/ristretto"
+	"github.com/Masterminds/squirrel"
 	"github.com/pghq/go-tea/trail"
 
+	"github.com/pghq/go-store/internal/key"
+	"github.com/pghq/go-store/internal/singleflight"
 	"github.com/pghq/go-store/provider"
 	"github.com/pghq/go-store/provider/pg"
 )
@@ -31,11 +36,21 @@ type contextKey = struct{}
 
 // Store an abstraction over database persistence
 type Store struct {
-	db    provider.Provider
-	cache *ristretto.Cache
+	db          provider.Provider
+	cache       Cache
+	generations *generations
+	broadcaster *broadcaster
+	flights     *singleflight.Group
+	stats       *cacheStats
+	softDelete  map[string]struct{}
+
+	revalidations chan struct{}
+	revalidating  *sync.Map
 }
 
 // Begin a transaction
+// if the context already holds a transaction, a nested transaction is started
+// using a savepoint and the options are ignored
 func (s Store) Begin(ctx context.Context, opts ...provider.TxOption) (Txn, error) {
 	span := trail.StartSpan(ctx, "Store.Begin")
 	defer span.Finish()
@@ -43,17 +58,53 @@ func (s Store) Begin(ctx context.Context, opts ...provider.TxOption) (Txn, error
 }
 
 // Do execute callback in a transaction
+// with a retry policy, the callback is re-run on serialization failures and deadlocks
+// unless the transaction is nested (only the root transaction can be retried)
 func (s Store) Do(ctx context.Context, fn func(tx Txn) error, opts ...provider.TxOption) error {
 	span := trail.StartSpan(ctx, "Store.Do")
 	defer span.Finish()
 
+	conf := provider.TxConfig{}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	_, nested := ctx.Value(contextKey{}).(Txn)
+	if conf.Retry == nil || nested {
+		return s.do(ctx, fn, opts...)
+	}
+
+	policy := retryPolicy(*conf.Retry)
+	for attempt := 1; ; attempt++ {
+		err := s.do(ctx, fn, opts...)
+		if err == nil || attempt >= policy.MaxAttempts || !pg.IsRetryable(err) {
+			span.Tags.Set("Store.Attempts", strconv.Itoa(attempt))
+			return err
+		}
+
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err)
+		}
+
+		timer := time.NewTimer(backoff(policy, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return trail.Stacktrace(ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// do execute callback in a single transaction
+func (s Store) do(ctx context.Context, fn func(tx Txn) error, opts ...provider.TxOption) (err error) {
 	tx, err := s.Begin(ctx, opts...)
 	if err != nil {
 		return trail.Stacktrace(err)
 	}
 
-	defer tx.rollback()
-	if err := fn(tx); err != nil {
+	defer func() { tx.rollback(err) }()
+	if err = fn(tx); err != nil {
 		return trail.Stacktrace(err)
 	}
 
@@ -70,24 +121,63 @@ func (s Store) BatchQuery(ctx context.Context, query provider.BatchQuery, opts .
 		opt(&conf)
 	}
 
+	specs := make([]provider.Spec, len(query))
+	for i, item := range query {
+		specs[i] = item.Spec
+	}
+
+	defer func() {
+		for i, item := range query {
+			item.Spec = specs[i]
+		}
+	}()
+
+	for _, item := range query {
+		spec, err := s.scope(item.Spec, conf)
+		if err != nil {
+			return trail.Stacktrace(err)
+		}
+
+		item.Spec = spec
+	}
+
 	for _, item := range query {
-		cv, present := s.cache.Get(item.Spec.Id())
-		if present {
-			if err := hydrate(item.Value, cv); err != nil {
-				return trail.Stacktrace(err)
+		entry, present := s.cacheGet(ctx, item.Spec.Id())
+		if present && entry.err != nil && item.One {
+			s.stats.record(conf.Collections, true)
+			if !item.Optional {
+				return trail.Stacktrace(entry.err)
 			}
+
+			item.Skip = true
+			continue
+		}
+
+		hit := present && entry.err == nil && hydrate(item.Value, entry.value) == nil
+		s.stats.record(conf.Collections, hit)
+		if hit {
+			if entry.stale() {
+				op := opAll
+				if item.One {
+					op = opOne
+				}
+
+				s.revalidate(op, item.Spec, item.Value, conf)
+			}
+
 			item.Skip = true
 		}
 	}
 
-	if err := s.db.Repository().BatchQuery(ctx, query); err != nil {
+	snapshot := s.generations.snapshot(conf.Collections)
+	if err := s.repository(ctx).BatchQuery(ctx, query); err != nil {
 		return trail.Stacktrace(err)
 	}
 
 	if conf.QueryTTL != 0 {
 		for _, item := range query {
 			if !item.Skip {
-				s.cache.SetWithTTL(item.Spec.Id(), item.Value, 1, conf.QueryTTL)
+				s.cacheSet(ctx, item.Spec.Id(), item.Value, snapshot, conf)
 			}
 		}
 	}
@@ -105,23 +195,71 @@ func (s Store) One(ctx context.Context, spec provider.Spec, v interface{}, opts
 		opt(&conf)
 	}
 
-	cv, present := s.cache.Get(spec.Id())
+	spec, err := s.scope(spec, conf)
+	if err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	entry, present := s.cacheGet(ctx, spec.Id())
+	if present && entry.err != nil {
+		s.stats.record(conf.Collections, true)
+		span.Tags.Set("Store.CacheHit", "true")
+		return trail.Stacktrace(entry.err)
+	}
+
+	present = present && hydrate(v, entry.value) == nil
+	s.stats.record(conf.Collections, present)
 	span.Tags.Set("Store.CacheHit", fmt.Sprintf("%t", present))
 	if present {
-		return hydrate(v, cv)
+		if entry.stale() {
+			s.revalidate(opOne, spec, v, conf)
+		}
+
+		return nil
 	}
 
-	if err := s.db.Repository().One(ctx, spec, v); err != nil {
+	snapshot := s.generations.snapshot(conf.Collections)
+	if err := s.query(ctx, opOne, spec, v, conf); err != nil {
+		if conf.QueryNegativeTTL != 0 && trail.IsNotFound(err) {
+			s.cacheNotFound(ctx, spec.Id(), err, snapshot, conf)
+		}
+
 		return trail.Stacktrace(err)
 	}
 
 	if conf.QueryTTL != 0 {
-		s.cache.SetWithTTL(spec.Id(), v, 1, conf.QueryTTL)
+		s.cacheSet(ctx, spec.Id(), v, snapshot, conf)
 	}
 
 	return nil
 }
 
+// Count counts the values matching the spec
+func (s Store) Count(ctx context.Context, spec provider.Spec, opts ...QueryOption) (int64, error) {
+	span := trail.StartSpan(ctx, "Store.Count")
+	defer span.Finish()
+
+	var n int64
+	if err := s.One(ctx, provider.CountSpec{Spec: spec}, &n, opts...); err != nil {
+		return 0, trail.Stacktrace(err)
+	}
+
+	return n, nil
+}
+
+// Exists checks if any value matches the spec
+func (s Store) Exists(ctx context.Context, spec provider.Spec, opts ...QueryOption) (bool, error) {
+	span := trail.StartSpan(ctx, "Store.Exists")
+	defer span.Finish()
+
+	var exists bool
+	if err := s.One(ctx, provider.ExistsSpec{Spec: spec}, &exists, opts...); err != nil {
+		return false, trail.Stacktrace(err)
+	}
+
+	return exists, nil
+}
+
 // All retrieves a listing of values
 func (s Store) All(ctx context.Context, spec provider.Spec, v interface{}, opts ...QueryOption) error {
 	span := trail.StartSpan(ctx, "Store.All")
@@ -132,64 +270,196 @@ func (s Store) All(ctx context.Context, spec provider.Spec, v interface{}, opts
 		opt(&conf)
 	}
 
-	cv, present := s.cache.Get(spec.Id())
+	spec, err := s.scope(spec, conf)
+	if err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	entry, present := s.cacheGet(ctx, spec.Id())
+	present = present && entry.err == nil && hydrate(v, entry.value) == nil
+	s.stats.record(conf.Collections, present)
 	span.Tags.Set("Store.CacheHit", fmt.Sprintf("%t", present))
 	if present {
-		return hydrate(v, cv)
+		if entry.stale() {
+			s.revalidate(opAll, spec, v, conf)
+		}
+
+		return nil
 	}
 
-	if err := s.db.Repository().All(ctx, spec, v); err != nil {
+	snapshot := s.generations.snapshot(conf.Collections)
+	if err := s.query(ctx, opAll, spec, v, conf); err != nil {
 		return trail.Stacktrace(err)
 	}
 
 	if conf.QueryTTL != 0 {
-		s.cache.SetWithTTL(spec.Id(), v, 1, conf.QueryTTL)
+		s.cacheSet(ctx, spec.Id(), v, snapshot, conf)
 	}
 
 	return nil
 }
 
 // Add appends a value to the collection
-func (s Store) Add(ctx context.Context, collection string, v interface{}) error {
+func (s Store) Add(ctx context.Context, collection string, v interface{}, opts ...provider.WriteOption) error {
 	span := trail.StartSpan(ctx, "Store.Add")
 	defer span.Finish()
 
-	return s.db.Repository().Add(ctx, collection, v)
+	err := s.repository(ctx).Add(ctx, collection, v, opts...)
+	s.invalidate(ctx, invalidation{Collections: []string{collection}})
+	return trail.Stacktrace(err)
+}
+
+// AddMany adds a slice of values to the collection
+// large slices are copied in bulk
+func (s Store) AddMany(ctx context.Context, collection string, v interface{}) error {
+	span := trail.StartSpan(ctx, "Store.AddMany")
+	defer span.Finish()
+
+	if err := s.repository(ctx).AddMany(ctx, collection, v); err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	s.invalidate(ctx, invalidation{Collections: []string{collection}})
+	return nil
+}
+
+// BatchWrite performs the write ops in a single round trip
+// each item holds its own error and number of rows affected
+func (s Store) BatchWrite(ctx context.Context, batch provider.BatchWrite) error {
+	span := trail.StartSpan(ctx, "Store.BatchWrite")
+	defer span.Finish()
+
+	writes := make([]provider.BatchWriteItem, len(batch))
+	for i, item := range batch {
+		writes[i] = *item
+		if s.softDeleted(item.Collection) {
+			switch item.Kind {
+			case provider.BatchEdit:
+				item.Spec = live(item.Spec)
+			case provider.BatchRemove:
+				item.Kind = provider.BatchEdit
+				item.Spec = live(item.Spec)
+				item.Value = map[string]interface{}{deletedAt: squirrel.Expr("now()")}
+			}
+		}
+	}
+
+	defer func() {
+		for i, item := range batch {
+			item.Kind, item.Spec, item.Value = writes[i].Kind, writes[i].Spec, writes[i].Value
+		}
+	}()
+
+	if err := s.repository(ctx).BatchWrite(ctx, batch); err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	var inv invalidation
+	for _, item := range batch {
+		inv.Collections = append(inv.Collections, item.Collection)
+		if item.Spec != nil {
+			inv.Keys = append(inv.Keys, item.Spec.Id())
+		}
+	}
+
+	s.invalidate(ctx, inv)
+	return nil
 }
 
 // Edit updates value(s) in the collection
-func (s Store) Edit(ctx context.Context, collection string, spec provider.Spec, v interface{}) error {
+func (s Store) Edit(ctx context.Context, collection string, spec provider.Spec, v interface{}, opts ...provider.WriteOption) error {
 	span := trail.StartSpan(ctx, "Store.Edit")
 	defer span.Finish()
 
-	return s.db.Repository().Edit(ctx, collection, spec, v)
+	where := spec
+	if s.softDeleted(collection) {
+		where = live(spec)
+	}
+
+	err := s.repository(ctx).Edit(ctx, collection, where, v, opts...)
+	s.invalidate(ctx, invalidation{Collections: []string{collection}, Keys: []interface{}{spec.Id()}})
+	return trail.Stacktrace(err)
+}
+
+// Upsert inserts a value into the collection or updates the update columns on conflict
+// conflicts are ignored if no update columns are specified
+// the version of versioned values is not refreshed if the returned rows are scanned into another value
+func (s Store) Upsert(ctx context.Context, collection string, v interface{}, conflictColumns, updateColumns []string, opts ...provider.WriteOption) error {
+	span := trail.StartSpan(ctx, "Store.Upsert")
+	defer span.Finish()
+
+	err := s.repository(ctx).Upsert(ctx, collection, v, conflictColumns, updateColumns, opts...)
+	s.invalidate(ctx, invalidation{Collections: []string{collection}})
+	return trail.Stacktrace(err)
 }
 
 // Remove deletes values(s) in the collection
-func (s Store) Remove(ctx context.Context, collection string, spec provider.Spec) error {
+func (s Store) Remove(ctx context.Context, collection string, spec provider.Spec, opts ...provider.WriteOption) error {
 	span := trail.StartSpan(ctx, "Store.Remove")
 	defer span.Finish()
 
-	s.cache.Del(spec.Id())
-	return s.db.Repository().Remove(ctx, collection, spec)
+	var err error
+	if s.softDeleted(collection) {
+		data := map[string]interface{}{deletedAt: squirrel.Expr("now()")}
+		err = s.repository(ctx).Edit(ctx, collection, live(spec), data, opts...)
+	} else {
+		err = s.repository(ctx).Remove(ctx, collection, spec, opts...)
+	}
+
+	s.invalidate(ctx, invalidation{Collections: []string{collection}, Keys: []interface{}{spec.Id()}})
+	return trail.Stacktrace(err)
+}
+
+// Invalidate evicts cached queries by spec id, including counts and exists checks of the specs
+func (s Store) Invalidate(ctx context.Context, specIds ...interface{}) {
+	span := trail.StartSpan(ctx, "Store.Invalidate")
+	defer span.Finish()
+
+	s.invalidate(ctx, invalidation{Keys: specIds})
+}
+
+// InvalidateCollection evicts cached queries reading from the collection
+func (s Store) InvalidateCollection(ctx context.Context, name string) {
+	span := trail.StartSpan(ctx, "Store.InvalidateCollection")
+	defer span.Finish()
+
+	s.invalidate(ctx, invalidation{Collections: []string{name}})
+}
+
+// PurgeCache evicts all cached queries
+func (s Store) PurgeCache(ctx context.Context) {
+	span := trail.StartSpan(ctx, "Store.PurgeCache")
+	defer span.Finish()
+
+	s.invalidate(ctx, invalidation{Purge: true})
+}
+
+// Close stops the background work of the store
+func (s Store) Close() {
+	if s.broadcaster != nil {
+		s.broadcaster.stop()
+	}
 }
 
 // NewStore creates a new store instance
-func NewStore(db provider.Provider) *Store {
-	s := Store{}
-	s.cache, _ = ristretto.NewCache(&ristretto.Config{
-		NumCounters: 1e7,
-		MaxCost:     1 << 30,
-		BufferItems: 64,
-	})
-	s.db = db
-	return &s
+// only the cache options apply as the database is already configured
+func NewStore(db provider.Provider, opts ...Option) *Store {
+	conf := Config{
+		RevalidationConcurrency: 16,
+	}
+
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	return newStore(db, conf)
 }
 
 // New creates a new instance of the data store
 func New(opts ...Option) (*Store, error) {
 	conf := Config{
-		DSN: os.Getenv("DATABASE_URL"),
+		DSN:                     os.Getenv("DATABASE_URL"),
+		RevalidationConcurrency: 16,
 	}
 
 	for _, opt := range opts {
@@ -201,14 +471,53 @@ func New(opts ...Option) (*Store, error) {
 		return nil, trail.Stacktrace(err)
 	}
 
-	return NewStore(db), nil
+	return newStore(db, conf), nil
+}
+
+// newStore creates a new store instance from a configuration
+func newStore(db provider.Provider, conf Config) *Store {
+	if conf.RevalidationConcurrency < 0 {
+		conf.RevalidationConcurrency = 0
+	}
+
+	s := Store{
+		db:          db,
+		cache:       conf.Cache,
+		generations: &generations{},
+		broadcaster: newBroadcaster(db, conf.InvalidationChannel),
+		flights:     &singleflight.Group{},
+		stats:       &cacheStats{},
+		softDelete:  make(map[string]struct{}),
+
+		revalidations: make(chan struct{}, conf.RevalidationConcurrency),
+		revalidating:  &sync.Map{},
+	}
+
+	if s.cache == nil {
+		s.cache = newDefaultCache(conf.CacheMetrics)
+	}
+
+	for _, collection := range conf.SoftDelete {
+		s.softDelete[collection] = struct{}{}
+	}
+
+	if s.broadcaster != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.broadcaster.stop = cancel
+		go s.listen(ctx)
+	}
+
+	return &s
 }
 
 // Txn A unit of work
 type Txn struct {
 	ctx   context.Context
+	base  context.Context
 	uow   provider.UnitOfWork
 	store *Store
+	hooks *hooks
+	cache *txnCache
 	root  bool
 	done  bool
 }
@@ -218,6 +527,18 @@ func (tx Txn) Context() context.Context {
 	return tx.ctx
 }
 
+// OnCommit registers a callback to run after the root transaction commits
+// callbacks run in registration order and panics are recovered
+func (tx Txn) OnCommit(fn func(ctx context.Context)) {
+	tx.hooks.onCommit(fn)
+}
+
+// OnRollback registers a callback to run after the transaction rolls back
+// callbacks of nested transactions run when their savepoint is rolled back
+func (tx Txn) OnRollback(fn func(ctx context.Context, err error)) {
+	tx.hooks.onRollback(fn)
+}
+
 // One retrieve the first value matching the spec
 func (tx Txn) One(spec provider.Spec, v interface{}, opts ...QueryOption) error {
 	return tx.store.One(tx.Context(), spec, v, opts...)
@@ -229,18 +550,43 @@ func (tx Txn) All(spec provider.Spec, v interface{}, opts ...QueryOption) error
 }
 
 // Add appends a value to the collection
-func (tx Txn) Add(collection string, v interface{}) error {
-	return tx.store.Add(tx.Context(), collection, v)
+func (tx Txn) Add(collection string, v interface{}, opts ...provider.WriteOption) error {
+	return tx.store.Add(tx.Context(), collection, v, opts...)
+}
+
+// AddMany adds a slice of values to the collection
+func (tx Txn) AddMany(collection string, v interface{}) error {
+	return tx.store.AddMany(tx.Context(), collection, v)
+}
+
+// BatchWrite performs the write ops in a single round trip within a transaction
+func (tx Txn) BatchWrite(batch provider.BatchWrite) error {
+	return tx.store.BatchWrite(tx.Context(), batch)
 }
 
 // Edit updates value(s) in the collection
-func (tx Txn) Edit(collection string, spec provider.Spec, v interface{}) error {
-	return tx.store.Edit(tx.Context(), collection, spec, v)
+func (tx Txn) Edit(collection string, spec provider.Spec, v interface{}, opts ...provider.WriteOption) error {
+	return tx.store.Edit(tx.Context(), collection, spec, v, opts...)
+}
+
+// Upsert inserts a value into the collection or updates the update columns on conflict
+func (tx Txn) Upsert(collection string, v interface{}, conflictColumns, updateColumns []string, opts ...provider.WriteOption) error {
+	return tx.store.Upsert(tx.Context(), collection, v, conflictColumns, updateColumns, opts...)
 }
 
 // Remove deletes values(s) in the collection
-func (tx Txn) Remove(collection string, spec provider.Spec) error {
-	return tx.store.Remove(tx.Context(), collection, spec)
+func (tx Txn) Remove(collection string, spec provider.Spec, opts ...provider.WriteOption) error {
+	return tx.store.Remove(tx.Context(), collection, spec, opts...)
+}
+
+// Count counts the values matching the spec within a transaction
+func (tx Txn) Count(spec provider.Spec, opts ...QueryOption) (int64, error) {
+	return tx.store.Count(tx.Context(), spec, opts...)
+}
+
+// Exists checks if any value matches the spec within a transaction
+func (tx Txn) Exists(spec provider.Spec, opts ...QueryOption) (bool, error) {
+	return tx.store.Exists(tx.Context(), spec, opts...)
 }
 
 // BatchQuery performs a batch query op within a transaction
@@ -248,29 +594,68 @@ func (tx Txn) BatchQuery(query provider.BatchQuery, opts ...QueryOption) error {
 	return tx.store.BatchQuery(tx.Context(), query, opts...)
 }
 
+// Invalidate evicts cached queries by spec id, including counts and exists checks of the specs
+func (tx Txn) Invalidate(specIds ...interface{}) {
+	tx.store.Invalidate(tx.Context(), specIds...)
+}
+
+// InvalidateCollection evicts cached queries reading from the collection
+func (tx Txn) InvalidateCollection(name string) {
+	tx.store.InvalidateCollection(tx.Context(), name)
+}
+
+// PurgeCache evicts all cached queries
+func (tx Txn) PurgeCache() {
+	tx.store.PurgeCache(tx.Context())
+}
+
 // commit submit a unit of work
+// nested units of work release their savepoint
+// the root unit of work publishes its staged cache values
 func (tx *Txn) commit() error {
-	if tx.done || !tx.root {
+	if tx.done {
 		return nil
 	}
 
 	tx.done = true
-	return tx.uow.Commit(tx.Context())
+	if err := tx.uow.Commit(tx.Context()); err != nil {
+		err = trail.Stacktrace(err)
+		tx.cache.reset()
+		tx.hooks.rolledBack(tx.base, err)
+		return err
+	}
+
+	if tx.root {
+		tx.cache.publish(*tx.store)
+	}
+
+	tx.hooks.committed(tx.base)
+	return nil
 }
 
 // rollback cancel a unit of work
-func (tx *Txn) rollback() {
-	if !tx.done && tx.root {
+// nested units of work roll back to their savepoint
+// staged cache values are discarded as they may reflect rolled back writes
+func (tx *Txn) rollback(err error) {
+	if !tx.done {
 		tx.done = true
 		tx.uow.Rollback(tx.Context())
+		tx.cache.reset()
+		tx.hooks.rolledBack(tx.base, err)
 	}
 }
 
 // Config a configuration for the store
 type Config struct {
-	DSN       string
-	Migration fs.ReadDirFS
-	PgOptions []pg.Option
+	DSN                 string
+	Migration           fs.ReadDirFS
+	PgOptions           []pg.Option
+	Cache               Cache
+	CacheMetrics        bool
+	InvalidationChannel string
+	SoftDelete          []string
+
+	RevalidationConcurrency int
 }
 
 // Option A store configuration option
@@ -290,6 +675,46 @@ func WithPg(opts ...pg.Option) Option {
 	}
 }
 
+// WithCache Use a custom cache for query results
+func WithCache(cache Cache) Option {
+	return func(conf *Config) {
+		conf.Cache = cache
+	}
+}
+
+// WithCacheMetrics Enable ristretto metrics (e.g., evictions and cost) of the default cache
+func WithCacheMetrics(flag bool) Option {
+	return func(conf *Config) {
+		conf.CacheMetrics = flag
+	}
+}
+
+// WithInvalidationChannel Broadcast cache invalidations to other store instances
+// writes notify the channel and each store listens on it to evict stale values locally
+func WithInvalidationChannel(channel string) Option {
+	return func(conf *Config) {
+		conf.InvalidationChannel = channel
+	}
+}
+
+// WithRevalidationConcurrency Use a custom limit of background refreshes for stale cached queries
+func WithRevalidationConcurrency(n int) Option {
+	return func(conf *Config) {
+		conf.RevalidationConcurrency = n
+	}
+}
+
+// WithSoftDelete Use soft delete for the collections
+// removed values have their deleted_at column set instead of being deleted.
+// reads of the collections exclude them by adding a condition to the spec, so they must use
+// select specs (see provider.NewSelectSpec); other specs tagged with the collections
+// (see QueryCollections) fail, and untagged ones can not be detected and are not filtered
+func WithSoftDelete(collections ...string) Option {
+	return func(conf *Config) {
+		conf.SoftDelete = append(conf.SoftDelete, collections...)
+	}
+}
+
 // WithDSN Use dsn
 func WithDSN(dsn string) Option {
 	return func(conf *Config) {
@@ -299,23 +724,90 @@ func WithDSN(dsn string) Option {
 
 // QueryConfig configuration for store queries
 type QueryConfig struct {
-	QueryTTL time.Duration
+	QueryTTL          time.Duration
+	QueryStaleTTL     time.Duration
+	QueryNegativeTTL  time.Duration
+	QueryMaxCacheCost int64
+	Deleted           bool
+	Collections       []string
+	Coalesce          bool
 }
 
 // QueryOption for customizing store queries
 type QueryOption func(conf *QueryConfig)
 
 // QueryTTL custom duration of time to cache queries for
+// writes only evict cached queries tagged with the written collection (see QueryCollections),
+// untagged queries are served until they expire or are invalidated by spec id
 func QueryTTL(duration time.Duration) QueryOption {
 	return func(conf *QueryConfig) {
 		conf.QueryTTL = duration
 	}
 }
 
+// QueryStaleTTL custom duration of time to serve queries past their TTL
+// stale results are returned while the query is refreshed in the background
+func QueryStaleTTL(duration time.Duration) QueryOption {
+	return func(conf *QueryConfig) {
+		conf.QueryStaleTTL = duration
+	}
+}
+
+// QueryNegativeTTL custom duration of time to cache not found results of single value queries
+func QueryNegativeTTL(duration time.Duration) QueryOption {
+	return func(conf *QueryConfig) {
+		conf.QueryNegativeTTL = duration
+	}
+}
+
+// QueryMaxCacheCost custom maximum cost (approximate size in bytes) of results to cache
+// larger results are not cached
+func QueryMaxCacheCost(cost int64) QueryOption {
+	return func(conf *QueryConfig) {
+		conf.QueryMaxCacheCost = cost
+	}
+}
+
+// WithDeleted include soft deleted values in the results
+func WithDeleted() QueryOption {
+	return func(conf *QueryConfig) {
+		conf.Deleted = true
+	}
+}
+
+// QueryCollections collections the query reads from
+// cached results are evicted when any of the collections is written to
+func QueryCollections(names ...string) QueryOption {
+	return func(conf *QueryConfig) {
+		conf.Collections = append(conf.Collections, names...)
+	}
+}
+
+// QueryCoalesce share a single database read between concurrent identical queries
+// has no effect within transactions
+func QueryCoalesce(flag bool) QueryOption {
+	return func(conf *QueryConfig) {
+		conf.Coalesce = flag
+	}
+}
+
 // begin create instance of a read/write database transaction
+// transactions begun within another transaction are nested using savepoints
 func begin(ctx context.Context, store *Store, opts ...provider.TxOption) (Txn, error) {
-	if tx, ok := ctx.Value(contextKey{}).(Txn); ok {
-		tx.root = false
+	if parent, ok := ctx.Value(contextKey{}).(Txn); ok {
+		uow, err := parent.uow.Savepoint(ctx)
+		if err != nil {
+			return Txn{}, trail.Stacktrace(err)
+		}
+
+		tx := Txn{
+			base:  ctx,
+			uow:   uow,
+			store: store,
+			hooks: &hooks{parent: parent.hooks},
+			cache: parent.cache,
+		}
+
 		tx.ctx = context.WithValue(ctx, contextKey{}, tx)
 		return tx, nil
 	}
@@ -326,8 +818,11 @@ func begin(ctx context.Context, store *Store, opts ...provider.TxOption) (Txn, e
 	}
 
 	tx := Txn{
+		base:  ctx,
 		uow:   uow,
 		store: store,
+		hooks: &hooks{},
+		cache: &txnCache{},
 		root:  true,
 	}
 
@@ -335,15 +830,100 @@ func begin(ctx context.Context, store *Store, opts ...provider.TxOption) (Txn, e
 	return tx, nil
 }
 
-// hydrate Copies src value to destination
-func hydrate(dst, src interface{}) error {
-	dv := reflect.Indirect(reflect.ValueOf(dst))
-	sv := reflect.Indirect(reflect.ValueOf(src))
+// repository gets the repository of the transaction bound to the context, if any
+func (s Store) repository(ctx context.Context) provider.Repository {
+	if tx, ok := ctx.Value(contextKey{}).(Txn); ok {
+		return tx.uow.Repository()
+	}
+
+	return s.db.Repository()
+}
+
+// query reads the spec from the repository
+// with coalescing, concurrent reads of the same spec outside a transaction share a single
+// database read, falling back to a separate read if the result can not be hydrated into v
+func (s Store) query(ctx context.Context, op operation, spec provider.Spec, v interface{}, conf QueryConfig) error {
+	read := func(ctx context.Context, v interface{}) error {
+		repo := s.repository(ctx)
+		if op == opOne {
+			return repo.One(ctx, spec, v)
+		}
+
+		return repo.All(ctx, spec, v)
+	}
+
+	_, inTx := ctx.Value(contextKey{}).(Txn)
+	rv := reflect.ValueOf(v)
+	if !conf.Coalesce || inTx || rv.Kind() != reflect.Ptr {
+		return read(ctx, v)
+	}
+
+	cv, shared, err := s.flights.Do(newFlightKey(op, spec.Id()), func() (interface{}, error) {
+		dst := reflect.New(rv.Type().Elem()).Interface()
+		return dst, read(ctx, dst)
+	})
+
+	if shared && (trail.IsError(err, context.Canceled) || trail.IsError(err, context.DeadlineExceeded)) {
+		return read(ctx, v)
+	}
 
-	if !dv.CanSet() || dv.Type() != sv.Type() {
-		return trail.NewError("bad hydration")
+	if err != nil {
+		return trail.Stacktrace(err)
+	}
+
+	if err := hydrate(v, cv); err != nil {
+		return read(ctx, v)
 	}
 
-	dv.Set(sv)
 	return nil
 }
+
+// operation a kind of read
+type operation int
+
+const (
+	opOne operation = iota
+	opAll
+)
+
+// flightKey identifies coalesced reads
+type flightKey struct {
+	op operation
+	id interface{}
+}
+
+// newFlightKey creates a new flight key for reads of the spec id
+func newFlightKey(op operation, id interface{}) flightKey {
+	return flightKey{op: op, id: key.Normalize(id)}
+}
+
+// retryPolicy fills in defaults for a retry policy
+func retryPolicy(policy provider.RetryPolicy) provider.RetryPolicy {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+
+	if policy.MinBackoff <= 0 {
+		policy.MinBackoff = 10 * time.Millisecond
+	}
+
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = time.Second
+	}
+
+	if policy.MaxBackoff < policy.MinBackoff {
+		policy.MaxBackoff = policy.MinBackoff
+	}
+
+	return policy
+}
+
+// backoff exponential delay with full jitter before retrying an attempt
+func backoff(policy provider.RetryPolicy, attempt int) time.Duration {
+	d := policy.MinBackoff << (attempt - 1)
+	if d <= 0 || d > policy.MaxBackoff {
+		d = policy.MaxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(d))) + 1
+}
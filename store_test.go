@@ -2,11 +2,16 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/fstest"
 	"time"
 
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
 	"github.com/pghq/go-tea/trail"
 	"github.com/stretchr/testify/assert"
 
@@ -32,6 +37,9 @@ func TestMain(m *testing.M) {
 		"migrations/00001_test.sql": &fstest.MapFile{
 			Data: []byte("-- +goose Up\nCREATE TABLE tests (id text primary key, name text, num int); \n create index idx_tests_name ON tests (name);"),
 		},
+		"migrations/00002_soft_tests.sql": &fstest.MapFile{
+			Data: []byte("-- +goose Up\nCREATE TABLE soft_tests (id text primary key, name text, deleted_at timestamptz);"),
+		},
 	}))
 	if err != nil {
 		panic(err)
@@ -61,6 +69,27 @@ func TestNew(t *testing.T) {
 	})
 }
 
+func TestNewStore(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("default cache", func(t *testing.T) {
+		s := NewStore(store.db)
+		assert.NotNil(t, s.cache)
+	})
+
+	t.Run("custom cache", func(t *testing.T) {
+		s := NewStore(store.db, WithCache(nopCache{}))
+		var v struct{ Id string }
+		query := spec("SELECT 'custom.cache:1234' AS id")
+		assert.Nil(t, s.One(context.TODO(), query, &v, QueryTTL(time.Minute)))
+		assert.Equal(t, "custom.cache:1234", v.Id)
+
+		_, present := s.cacheGet(context.TODO(), query.Id())
+		assert.False(t, present)
+	})
+}
+
 func TestStore_Do(t *testing.T) {
 	trail.Testing()
 	t.Parallel()
@@ -77,6 +106,70 @@ func TestStore_Do(t *testing.T) {
 		}))
 	})
 
+	t.Run("rollback", func(t *testing.T) {
+		assert.NotNil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if err := tx.Add("tests", map[string]interface{}{"id": "do.rollback:1234"}); err != nil {
+				return err
+			}
+
+			return trail.NewError("")
+		}))
+
+		var v struct{ Id string }
+		err := store.One(context.TODO(), spec("SELECT id FROM tests WHERE id = 'do.rollback:1234'"), &v)
+		assert.True(t, trail.IsNotFound(err))
+	})
+
+	t.Run("uncommitted writes are isolated", func(t *testing.T) {
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if err := tx.Add("tests", map[string]interface{}{"id": "do.isolated:1234"}); err != nil {
+				return err
+			}
+
+			var v struct{ Id string }
+			if err := tx.One(spec("SELECT id FROM tests WHERE id = 'do.isolated:1234'"), &v); err != nil {
+				return err
+			}
+
+			err := store.One(context.TODO(), spec("SELECT id FROM tests WHERE id = 'do.isolated:1234'"), &v)
+			assert.True(t, trail.IsNotFound(err))
+			return nil
+		}))
+	})
+
+	t.Run("nested rollback", func(t *testing.T) {
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if err := tx.Add("tests", map[string]interface{}{"id": "do.nested:outer"}); err != nil {
+				return err
+			}
+
+			assert.NotNil(t, store.Do(tx.Context(), func(tx Txn) error {
+				if err := tx.Add("tests", map[string]interface{}{"id": "do.nested:inner"}); err != nil {
+					return err
+				}
+
+				return trail.NewError("")
+			}))
+
+			return nil
+		}))
+
+		var v struct{ Id string }
+		assert.Nil(t, store.One(context.TODO(), spec("SELECT id FROM tests WHERE id = 'do.nested:outer'"), &v))
+		err := store.One(context.TODO(), spec("SELECT id FROM tests WHERE id = 'do.nested:inner'"), &v)
+		assert.True(t, trail.IsNotFound(err))
+	})
+
+	t.Run("nested recovers from failed statement", func(t *testing.T) {
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			_ = store.Do(tx.Context(), func(tx Txn) error {
+				return tx.Add("tests", map[string]interface{}{"id": "do.nested.recover:1234", "num": "bad"})
+			})
+
+			return tx.Add("tests", map[string]interface{}{"id": "do.nested.recover:1234"})
+		}))
+	})
+
 	t.Run("ok", func(t *testing.T) {
 		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
 			return store.Do(tx.Context(), func(tx Txn) error {
@@ -86,6 +179,168 @@ func TestStore_Do(t *testing.T) {
 	})
 }
 
+func TestStore_Do_Retry(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		var attempts, retries int
+		err := store.Do(context.TODO(), func(tx Txn) error {
+			attempts++
+			if attempts < 3 {
+				return &pgconn.PgError{Code: "40001"}
+			}
+
+			return nil
+		}, provider.WithRetry(provider.RetryPolicy{
+			MinBackoff: time.Millisecond,
+			OnRetry:    func(int, error) { retries++ },
+		}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 2, retries)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		var attempts int
+		err := store.Do(context.TODO(), func(tx Txn) error {
+			attempts++
+			return &pgconn.PgError{Code: "40P01"}
+		}, provider.WithRetry(provider.RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond}))
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("non-transient errors", func(t *testing.T) {
+		var attempts int
+		err := store.Do(context.TODO(), func(tx Txn) error {
+			attempts++
+			return trail.NewError("")
+		}, provider.WithRetry(provider.RetryPolicy{}))
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		var attempts int
+		assert.NotNil(t, store.Do(context.TODO(), func(tx Txn) error {
+			return store.Do(tx.Context(), func(tx Txn) error {
+				attempts++
+				return &pgconn.PgError{Code: "40001"}
+			}, provider.WithRetry(provider.RetryPolicy{}))
+		}))
+
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		err := store.Do(ctx, func(tx Txn) error {
+			cancel()
+			return &pgconn.PgError{Code: "40001"}
+		}, provider.WithRetry(provider.RetryPolicy{MinBackoff: time.Minute}))
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestTxn_OnCommit(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("rollback", func(t *testing.T) {
+		var called bool
+		assert.NotNil(t, store.Do(context.TODO(), func(tx Txn) error {
+			tx.OnCommit(func(ctx context.Context) { called = true })
+			return trail.NewError("")
+		}))
+		assert.False(t, called)
+	})
+
+	t.Run("nested rollback", func(t *testing.T) {
+		var called bool
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			_ = store.Do(tx.Context(), func(tx Txn) error {
+				tx.OnCommit(func(ctx context.Context) { called = true })
+				return trail.NewError("")
+			})
+			return nil
+		}))
+		assert.False(t, called)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		var calls []string
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			tx.OnCommit(func(ctx context.Context) { calls = append(calls, "first") })
+			tx.OnCommit(func(ctx context.Context) { panic("an error has occurred") })
+			err := store.Do(tx.Context(), func(tx Txn) error {
+				tx.OnCommit(func(ctx context.Context) {
+					_, ok := ctx.Value(contextKey{}).(Txn)
+					assert.False(t, ok)
+					calls = append(calls, "nested")
+				})
+				return nil
+			})
+
+			assert.Empty(t, calls)
+			return err
+		}))
+		assert.Equal(t, []string{"first", "nested"}, calls)
+	})
+}
+
+func TestTxn_OnRollback(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("commit", func(t *testing.T) {
+		var called bool
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			tx.OnRollback(func(ctx context.Context, err error) { called = true })
+			return nil
+		}))
+		assert.False(t, called)
+	})
+
+	t.Run("nested rollback", func(t *testing.T) {
+		var calls []string
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			_ = store.Do(tx.Context(), func(tx Txn) error {
+				tx.OnRollback(func(ctx context.Context, err error) {
+					_, ok := ctx.Value(contextKey{}).(Txn)
+					assert.True(t, ok)
+					calls = append(calls, "nested")
+				})
+				return trail.NewError("")
+			})
+			assert.Equal(t, []string{"nested"}, calls)
+			return nil
+		}))
+		assert.Equal(t, []string{"nested"}, calls)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		var calls []string
+		assert.NotNil(t, store.Do(context.TODO(), func(tx Txn) error {
+			tx.OnRollback(func(ctx context.Context, err error) {
+				assert.NotNil(t, err)
+				calls = append(calls, "first")
+			})
+			tx.OnRollback(func(ctx context.Context, err error) { panic("an error has occurred") })
+			_ = store.Do(tx.Context(), func(tx Txn) error {
+				tx.OnRollback(func(ctx context.Context, err error) { calls = append(calls, "nested") })
+				return nil
+			})
+			return trail.NewError("")
+		}))
+		assert.Equal(t, []string{"first", "nested"}, calls)
+	})
+}
+
 func TestTxn_Add(t *testing.T) {
 	trail.Testing()
 	t.Parallel()
@@ -95,6 +350,66 @@ func TestTxn_Add(t *testing.T) {
 			return tx.Add("tests", map[string]interface{}{"id": "1234"})
 		}))
 	})
+
+	t.Run("returning", func(t *testing.T) {
+		var v struct{ Id string }
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			return tx.Add("tests", map[string]interface{}{"id": "add.returning:1234"}, provider.WithReturning(&v, "id"))
+		}))
+		assert.Equal(t, "add.returning:1234", v.Id)
+	})
+}
+
+func TestTxn_AddMany(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			return tx.AddMany("tests", []map[string]interface{}{{"id": "add.many:1234"}, {"id": "add.many:12345"}})
+		}))
+	})
+}
+
+func TestTxn_BatchWrite(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		batch := provider.BatchWrite{}
+		batch.Add("tests", map[string]interface{}{"id": "batch.write:1234"})
+		batch.Edit("tests", spec("id = 'batch.write:1234'"), map[string]interface{}{"name": "foo"})
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			return tx.BatchWrite(batch)
+		}))
+		assert.Equal(t, int64(1), batch[1].RowsAffected)
+	})
+}
+
+func TestStore_BatchWrite(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	query := spec("SELECT name FROM tests WHERE id = 'batch.write:12345'")
+	_ = store.Add(context.TODO(), "tests", map[string]interface{}{"id": "batch.write:12345", "name": "foo"})
+
+	t.Run("bad sql", func(t *testing.T) {
+		batch := provider.BatchWrite{}
+		batch.Remove("", spec(""))
+		assert.NotNil(t, store.BatchWrite(context.TODO(), batch))
+	})
+
+	t.Run("invalidates collection", func(t *testing.T) {
+		var v struct{ Name string }
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		wait(store)
+
+		batch := provider.BatchWrite{}
+		batch.Edit("tests", spec("id = 'batch.write:12345'"), map[string]interface{}{"name": "bar"})
+		assert.Nil(t, store.BatchWrite(context.TODO(), batch))
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		assert.Equal(t, "bar", v.Name)
+	})
 }
 
 func TestTxn_Edit(t *testing.T) {
@@ -110,6 +425,73 @@ func TestTxn_Edit(t *testing.T) {
 			return tx.Edit("tests", spec("id = 'edit:1234'"), map[string]interface{}{"id": "edit:1234"})
 		}))
 	})
+
+	t.Run("must match", func(t *testing.T) {
+		err := store.Do(context.TODO(), func(tx Txn) error {
+			return tx.Edit("tests", spec("id = 'edit:foo'"), map[string]interface{}{"name": "foo"}, provider.WithMustMatch())
+		})
+		assert.NotNil(t, err)
+		assert.True(t, trail.IsNotFound(err))
+	})
+}
+
+func TestTxn_Upsert(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			return tx.Upsert("tests", map[string]interface{}{"id": "upsert:1234", "name": "foo"}, []string{"id"}, []string{"name"})
+		}))
+	})
+}
+
+func TestStore_Upsert(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	query := spec("SELECT name FROM tests WHERE id = 'upsert:12345'")
+	_ = store.Add(context.TODO(), "tests", map[string]interface{}{"id": "upsert:12345", "name": "foo"})
+
+	t.Run("bad sql", func(t *testing.T) {
+		assert.NotNil(t, store.Upsert(context.TODO(), "", nil, nil, nil))
+	})
+
+	t.Run("invalidates collection", func(t *testing.T) {
+		var v struct{ Name string }
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		wait(store)
+
+		assert.Nil(t, store.Upsert(context.TODO(), "tests", map[string]interface{}{"id": "upsert:12345", "name": "bar"}, []string{"id"}, []string{"name"}))
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		assert.Equal(t, "bar", v.Name)
+	})
+}
+
+func TestStore_Edit(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	query := spec("SELECT id, name FROM tests WHERE id LIKE 'store.edit:%'")
+	_ = store.AddMany(context.TODO(), "tests", []map[string]interface{}{{"id": "store.edit:1234"}, {"id": "store.edit:12345"}})
+
+	t.Run("returning many rows into one value", func(t *testing.T) {
+		var v []struct {
+			Id   string
+			Name *string
+		}
+		assert.Nil(t, store.All(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		wait(store)
+
+		var one struct{ Id string }
+		var n int64
+		assert.Nil(t, store.Edit(context.TODO(), "tests", spec("id LIKE 'store.edit:%'"), map[string]interface{}{"name": "foo"}, provider.WithReturning(&one, "id"), provider.WithRowsAffected(&n)))
+		assert.Contains(t, one.Id, "store.edit:")
+		assert.Equal(t, int64(2), n)
+
+		assert.Nil(t, store.All(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		assert.Equal(t, "foo", *v[0].Name)
+	})
 }
 
 func TestTxn_Remove(t *testing.T) {
@@ -155,7 +537,7 @@ func TestTxn_One(t *testing.T) {
 			var v struct{ Id string }
 			assert.NotNil(t, store.Do(context.TODO(), func(tx Txn) error {
 				_ = tx.One(spec("SELECT id FROM tests WHERE id = 'one:1234'"), &v, QueryTTL(time.Minute))
-				tx.store.cache.Wait()
+				wait(tx.store)
 				return tx.One(spec("SELECT id FROM tests WHERE id = 'one:1234'"), func() {}, QueryTTL(time.Minute))
 			}))
 		})
@@ -164,7 +546,7 @@ func TestTxn_One(t *testing.T) {
 			var v struct{ Id string }
 			assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
 				_ = tx.One(spec("SELECT id FROM tests WHERE id = 'one:1234'"), &v, QueryTTL(time.Minute))
-				tx.store.cache.Wait()
+				wait(tx.store)
 				return tx.One(spec("SELECT id FROM tests WHERE id = 'one:1234'"), &v, QueryTTL(time.Minute))
 			}))
 			assert.Equal(t, "one:1234", v.Id)
@@ -172,6 +554,89 @@ func TestTxn_One(t *testing.T) {
 	})
 }
 
+func TestTxn_Count(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	_ = store.Add(context.TODO(), "tests", map[string]interface{}{"id": "count:1234"})
+
+	t.Run("ok", func(t *testing.T) {
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			n, err := tx.Count(spec("SELECT id FROM tests WHERE id = 'count:1234'"))
+			assert.Equal(t, int64(1), n)
+			return err
+		}))
+	})
+}
+
+func TestTxn_Exists(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			exists, err := tx.Exists(spec("SELECT id FROM tests WHERE id = 'exists:foo'"))
+			assert.False(t, exists)
+			return err
+		}))
+	})
+}
+
+func TestStore_Count(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	_ = store.Add(context.TODO(), "tests", map[string]interface{}{"id": "store.count:1234"})
+	query := spec("SELECT id FROM tests WHERE id LIKE 'store.count:%'")
+
+	t.Run("bad sql", func(t *testing.T) {
+		_, err := store.Count(context.TODO(), spec("bad"))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		n, err := store.Count(context.TODO(), query, QueryTTL(time.Minute), QueryCollections("tests"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+		wait(store)
+
+		_, present := store.cache.Get(provider.CountSpec{Spec: query}.Id())
+		assert.True(t, present)
+
+		_ = store.Add(context.TODO(), "tests", map[string]interface{}{"id": "store.count:12345"})
+		n, err = store.Count(context.TODO(), query, QueryTTL(time.Minute), QueryCollections("tests"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), n)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		var n int64
+		var exists bool
+		batch := provider.BatchQuery{}
+		batch.Count(query, &n)
+		batch.Exists(query, &exists)
+		assert.Nil(t, store.BatchQuery(context.TODO(), batch))
+		assert.NotZero(t, n)
+		assert.True(t, exists)
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		s := NewStore(store.db, WithSoftDelete("soft_tests"))
+		_ = s.Add(context.TODO(), "soft_tests", map[string]interface{}{"id": "soft.count:1234"})
+		_ = s.Remove(context.TODO(), "soft_tests", spec("id = 'soft.count:1234'"))
+
+		builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+		query := provider.NewSelectSpec("soft.count:1234", builder.Select("id").From("soft_tests").Where("id = ?", "soft.count:1234"), "soft_tests")
+		exists, err := s.Exists(context.TODO(), query)
+		assert.Nil(t, err)
+		assert.False(t, exists)
+
+		n, err := s.Count(context.TODO(), query, WithDeleted())
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+}
+
 func TestTxn_All(t *testing.T) {
 	trail.Testing()
 	t.Parallel()
@@ -200,7 +665,7 @@ func TestTxn_All(t *testing.T) {
 			var v []struct{ Id string }
 			assert.NotNil(t, store.Do(context.TODO(), func(tx Txn) error {
 				_ = tx.All(spec("SELECT id FROM tests WHERE id = 'all:1234'"), &v, QueryTTL(time.Minute))
-				tx.store.cache.Wait()
+				wait(tx.store)
 				return tx.All(spec("SELECT id FROM tests WHERE id = 'all:1234'"), func() {}, QueryTTL(time.Minute))
 			}))
 		})
@@ -250,7 +715,7 @@ func TestTxn_BatchQuery(t *testing.T) {
 				batch := provider.BatchQuery{}
 				batch.All(spec("SELECT id FROM tests WHERE id = 'batch.query:1234'"), &v)
 				_ = tx.BatchQuery(batch, QueryTTL(time.Minute))
-				tx.store.cache.Wait()
+				wait(tx.store)
 
 				batch = provider.BatchQuery{}
 				batch.All(spec("SELECT id FROM tests WHERE id = 'batch.query:1234'"), func() {})
@@ -264,7 +729,7 @@ func TestTxn_BatchQuery(t *testing.T) {
 				batch := provider.BatchQuery{}
 				batch.All(spec("SELECT id FROM tests WHERE id = 'batch.query:1234'"), &v)
 				_ = tx.BatchQuery(batch, QueryTTL(time.Minute))
-				tx.store.cache.Wait()
+				wait(tx.store)
 				return tx.BatchQuery(batch, QueryTTL(time.Minute))
 			}))
 			assert.Equal(t, "batch.query:1234", v[0].Id)
@@ -272,6 +737,744 @@ func TestTxn_BatchQuery(t *testing.T) {
 	})
 }
 
+func TestStore_CacheInvalidation(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	_ = store.Add(context.TODO(), "tests", map[string]interface{}{"id": "invalidation:1234", "name": "foo"})
+
+	t.Run("edit", func(t *testing.T) {
+		var v struct{ Name string }
+		query := spec("SELECT name FROM tests WHERE id = 'invalidation:1234'")
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		wait(store)
+
+		assert.Nil(t, store.Edit(context.TODO(), "tests", spec("id = 'invalidation:1234'"), map[string]interface{}{"name": "bar"}))
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		assert.Equal(t, "bar", v.Name)
+	})
+
+	t.Run("add", func(t *testing.T) {
+		var v []struct{ Id string }
+		query := spec("SELECT id FROM tests WHERE id LIKE 'invalidation.add:%'")
+		assert.Nil(t, store.All(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		wait(store)
+
+		assert.Nil(t, store.Add(context.TODO(), "tests", map[string]interface{}{"id": "invalidation.add:1234"}))
+		assert.Nil(t, store.All(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		assert.Len(t, v, 1)
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		var v []struct{ Id string }
+		query := spec("SELECT id FROM tests WHERE id LIKE 'invalidation.tx:%'")
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if err := tx.Add("tests", map[string]interface{}{"id": "invalidation.tx:1234"}); err != nil {
+				return err
+			}
+
+			_ = store.All(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests"))
+			wait(store)
+			return nil
+		}))
+
+		assert.Nil(t, store.All(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		assert.Len(t, v, 1)
+	})
+
+	t.Run("other collections", func(t *testing.T) {
+		var v struct{ Name string }
+		query := spec("SELECT name FROM tests WHERE id = 'invalidation:1234'")
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		wait(store)
+
+		store.generations.bump("others")
+		_, present := store.cacheGet(context.TODO(), query.Id())
+		assert.True(t, present)
+	})
+}
+
+func TestStore_InvalidationChannel(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	writer := NewStore(store.db, WithInvalidationChannel("store.invalidation"))
+	defer writer.Close()
+
+	reader := NewStore(store.db, WithInvalidationChannel("store.invalidation"))
+	defer reader.Close()
+
+	_ = writer.Add(context.TODO(), "tests", map[string]interface{}{"id": "invalidation.channel:1234"})
+
+	// wait for the reader to start listening
+	assert.Eventually(t, func() bool {
+		writer.broadcast(context.TODO(), invalidation{Collections: []string{"ping"}})
+		return !reader.generations.fresh(map[string]uint64{"ping": 0})
+	}, 10*time.Second, 100*time.Millisecond)
+
+	t.Run("collections", func(t *testing.T) {
+		var v []struct{ Id string }
+		query := spec("SELECT id FROM tests WHERE id LIKE 'invalidation.channel.collections:%'")
+		assert.Nil(t, reader.All(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		wait(reader)
+
+		assert.Nil(t, writer.Add(context.TODO(), "tests", map[string]interface{}{"id": "invalidation.channel.collections:1234"}))
+		assert.Eventually(t, func() bool {
+			_, present := reader.cacheGet(context.TODO(), query.Id())
+			return !present
+		}, 10*time.Second, 100*time.Millisecond)
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("id = 'invalidation.channel:1234'")
+		assert.Nil(t, reader.One(context.TODO(), spec("SELECT id FROM tests WHERE id = 'invalidation.channel:1234'"), &v))
+		reader.cacheSet(context.TODO(), query.Id(), &v, nil, QueryConfig{QueryTTL: time.Minute})
+		wait(reader)
+
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			return writer.Edit(tx.Context(), "tests", query, map[string]interface{}{"name": "foo"})
+		}))
+
+		assert.Eventually(t, func() bool {
+			_, present := reader.cacheGet(context.TODO(), query.Id())
+			return !present
+		}, 10*time.Second, 100*time.Millisecond)
+	})
+
+	t.Run("non-string keys", func(t *testing.T) {
+		v := struct{ Id string }{Id: "invalidation.channel:1234"}
+		reader.cacheSet(context.TODO(), 1234, &v, nil, QueryConfig{QueryTTL: time.Minute})
+		wait(reader)
+
+		writer.Invalidate(context.TODO(), 1234)
+		assert.Eventually(t, func() bool {
+			_, present := reader.cacheGet(context.TODO(), 1234)
+			return !present
+		}, 10*time.Second, 100*time.Millisecond)
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		v := struct{ Id string }{Id: "invalidation.channel:1234"}
+		reader.cacheSet(context.TODO(), "invalidation.channel.oversized:1234", &v, nil, QueryConfig{QueryTTL: time.Minute})
+		wait(reader)
+
+		keys := []interface{}{"invalidation.channel.oversized:1234"}
+		for i := 0; i < maxNotificationSize/10; i++ {
+			keys = append(keys, fmt.Sprintf("oversized:%d", i))
+		}
+
+		writer.Invalidate(context.TODO(), keys...)
+		assert.Eventually(t, func() bool {
+			_, present := reader.cacheGet(context.TODO(), "invalidation.channel.oversized:1234")
+			return !present
+		}, 10*time.Second, 100*time.Millisecond)
+	})
+}
+
+func TestStore_QueryCoalesce(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	db := countingProvider{Provider: store.db, reads: new(int32)}
+	s := NewStore(db)
+
+	t.Run("incompatible values", func(t *testing.T) {
+		var wg sync.WaitGroup
+		query := spec("SELECT 'coalesce:1234' AS id FROM pg_sleep(0.1)")
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i == 0 {
+					var v struct{ Id string }
+					assert.Nil(t, s.One(context.TODO(), query, &v, QueryCoalesce(true)))
+					assert.Equal(t, "coalesce:1234", v.Id)
+					return
+				}
+
+				var v struct {
+					Id   string
+					Name *string
+				}
+				assert.Nil(t, s.One(context.TODO(), query, &v, QueryCoalesce(true)))
+				assert.Equal(t, "coalesce:1234", v.Id)
+			}(i)
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		atomic.StoreInt32(db.reads, 0)
+		var wg sync.WaitGroup
+		query := spec("SELECT 'coalesce:1234' AS id FROM pg_sleep(0.5)")
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var v []struct{ Id string }
+				assert.Nil(t, s.All(context.TODO(), query, &v, QueryCoalesce(true)))
+				assert.Equal(t, "coalesce:1234", v[0].Id)
+			}()
+		}
+
+		wg.Wait()
+		assert.Less(t, atomic.LoadInt32(db.reads), int32(10))
+	})
+
+	t.Run("byte ids", func(t *testing.T) {
+		var v struct{ Id string }
+		query := bytesSpec("SELECT 'coalesce:1234' AS id")
+		assert.Nil(t, s.One(context.TODO(), query, &v, QueryCoalesce(true)))
+		assert.Equal(t, "coalesce:1234", v.Id)
+	})
+}
+
+func TestStore_QueryStaleTTL(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	_ = store.Add(context.TODO(), "tests", map[string]interface{}{"id": "stale:1234", "name": "foo"})
+
+	t.Run("ok", func(t *testing.T) {
+		var v struct{ Name string }
+		query := spec("SELECT name FROM tests WHERE id = 'stale:1234'")
+		opts := []QueryOption{QueryTTL(10 * time.Millisecond), QueryStaleTTL(time.Minute)}
+		assert.Nil(t, store.One(context.TODO(), query, &v, opts...))
+		wait(store)
+		time.Sleep(20 * time.Millisecond)
+
+		// bypass the store so the cached value is not invalidated
+		assert.Nil(t, store.db.Repository().Edit(context.TODO(), "tests", spec("id = 'stale:1234'"), map[string]interface{}{"name": "bar"}))
+		assert.Nil(t, store.One(context.TODO(), query, &v, opts...))
+		assert.Equal(t, "foo", v.Name)
+
+		assert.Eventually(t, func() bool {
+			wait(store)
+			entry, present := store.cacheGet(context.TODO(), query.Id())
+			return present && hydrate(&v, entry.value) == nil && v.Name == "bar"
+		}, 10*time.Second, 10*time.Millisecond)
+	})
+	t.Run("byte ids", func(t *testing.T) {
+		var v struct{ Name string }
+		query := bytesSpec("SELECT name FROM tests WHERE id = 'stale:1234' AND 'bytes' = 'bytes'")
+		opts := []QueryOption{QueryTTL(10 * time.Millisecond), QueryStaleTTL(time.Minute)}
+		assert.Nil(t, store.One(context.TODO(), query, &v, opts...))
+		wait(store)
+		time.Sleep(20 * time.Millisecond)
+
+		assert.Nil(t, store.One(context.TODO(), query, &v, opts...))
+		assert.NotEmpty(t, v.Name)
+	})
+}
+
+func TestStore_QueryNegativeTTL(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("not found", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT id FROM tests WHERE id = 'negative:1234'")
+		opts := []QueryOption{QueryTTL(time.Minute), QueryNegativeTTL(time.Minute), QueryCollections("tests")}
+		err := store.One(context.TODO(), query, &v, opts...)
+		assert.True(t, trail.IsNotFound(err))
+		wait(store)
+
+		// bypass the store so the cached value is not invalidated
+		assert.Nil(t, store.db.Repository().Add(context.TODO(), "tests", map[string]interface{}{"id": "negative:1234"}))
+		assert.Equal(t, err, store.One(context.TODO(), query, &v, opts...))
+
+		batch := provider.BatchQuery{}
+		batch.One(query, &v, provider.WithBatchItemOptional(true))
+		assert.Nil(t, store.BatchQuery(context.TODO(), batch))
+
+		batch = provider.BatchQuery{}
+		batch.One(query, &v)
+		assert.True(t, trail.IsNotFound(store.BatchQuery(context.TODO(), batch)))
+
+		assert.Nil(t, store.Edit(context.TODO(), "tests", spec("id = 'negative:1234'"), map[string]interface{}{"name": "foo"}))
+		assert.Nil(t, store.One(context.TODO(), query, &v, opts...))
+		assert.Equal(t, "negative:1234", v.Id)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT id FROM tests WHERE id = 'negative:12345'")
+		err := store.One(context.TODO(), query, &v, QueryTTL(time.Minute))
+		assert.True(t, trail.IsNotFound(err))
+		wait(store)
+
+		_, present := store.cacheGet(context.TODO(), query.Id())
+		assert.False(t, present)
+	})
+}
+
+func TestStore_CacheAliasing(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		var v []struct{ Tags []string }
+		query := spec("SELECT ARRAY['foo'] AS tags")
+		assert.Nil(t, store.All(context.TODO(), query, &v, QueryTTL(time.Minute)))
+		wait(store)
+		v[0].Tags[0] = "bar"
+
+		var cv []struct{ Tags []string }
+		assert.Nil(t, store.All(context.TODO(), query, &cv, QueryTTL(time.Minute)))
+		assert.Equal(t, "foo", cv[0].Tags[0])
+		cv[0].Tags[0] = "baz"
+
+		assert.Nil(t, store.All(context.TODO(), query, &cv, QueryTTL(time.Minute)))
+		assert.Equal(t, "foo", cv[0].Tags[0])
+	})
+}
+
+func TestStore_QueryMaxCacheCost(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("oversized", func(t *testing.T) {
+		query := spec("SELECT 'cost:1234' AS id, repeat('x', 1024) AS body")
+		var v struct{ Id, Body string }
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryMaxCacheCost(512)))
+		wait(store)
+
+		_, present := store.cache.Get(query.Id())
+		assert.False(t, present)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		query := spec("SELECT 'cost:12345' AS id, repeat('x', 128) AS body")
+		var v struct{ Id, Body string }
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryMaxCacheCost(512)))
+		wait(store)
+
+		_, present := store.cache.Get(query.Id())
+		assert.True(t, present)
+	})
+}
+
+func TestStore_CacheHydration(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	type base struct {
+		Id string
+	}
+
+	type row struct {
+		base
+		Name string `db:"name"`
+		Num  *int
+	}
+
+	t.Run("compatible", func(t *testing.T) {
+		query := spec("SELECT 'hydration:1234' AS id, 'foo' AS name, 1 AS num")
+		var v []row
+		assert.Nil(t, store.All(context.TODO(), query, &v, QueryTTL(time.Minute)))
+		wait(store)
+
+		var cv []struct {
+			Id     string
+			Title  string `db:"name"`
+			Ignore int    `db:"-"`
+		}
+		assert.Nil(t, store.All(context.TODO(), query, &cv, QueryTTL(time.Minute)))
+		assert.Equal(t, "hydration:1234", cv[0].Id)
+		assert.Equal(t, "foo", cv[0].Title)
+	})
+
+	t.Run("incompatible", func(t *testing.T) {
+		query := spec("SELECT 'hydration:1234' AS id, 'foo' AS name")
+		var v struct{ Id string }
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute)))
+		wait(store)
+
+		var cv struct {
+			Id   string
+			Name string
+		}
+		assert.Nil(t, store.One(context.TODO(), query, &cv, QueryTTL(time.Minute)))
+		assert.Equal(t, "foo", cv.Name)
+
+		var tv struct{ Id int }
+		assert.NotNil(t, hydrate(&tv, &cv))
+	})
+}
+
+func TestStore_CacheStats(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	s := NewStore(store.db, WithCacheMetrics(true))
+
+	t.Run("empty", func(t *testing.T) {
+		stats := s.CacheStats()
+		assert.Equal(t, uint64(0), stats.Hits)
+		assert.Equal(t, float64(0), stats.HitRatio)
+		assert.Empty(t, stats.Collections)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		query := spec("SELECT 'stats:1234' AS id")
+		for i := 0; i < 4; i++ {
+			var v struct{ Id string }
+			assert.Nil(t, s.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+			wait(s)
+		}
+
+		var v []struct{ Id string }
+		assert.Nil(t, s.All(context.TODO(), spec("SELECT 'stats:12345' AS id"), &v))
+
+		stats := s.CacheStats()
+		assert.Equal(t, uint64(3), stats.Hits)
+		assert.Equal(t, uint64(2), stats.Misses)
+		assert.Equal(t, 0.6, stats.HitRatio)
+		assert.NotZero(t, stats.CostUsed)
+		assert.Equal(t, CollectionCacheStats{Hits: 3, Misses: 1, HitRatio: 0.75}, stats.Collections["tests"])
+	})
+}
+
+func TestStore_SoftDelete(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+	s := NewStore(store.db, WithSoftDelete("soft_tests"))
+	query := provider.NewSelectSpec("soft.delete:1234", builder.Select("id").From("soft_tests").Where("id = ?", "soft.delete:1234"), "soft_tests")
+	_ = s.Add(context.TODO(), "soft_tests", map[string]interface{}{"id": "soft.delete:1234"})
+
+	t.Run("remove", func(t *testing.T) {
+		assert.Nil(t, s.Remove(context.TODO(), "soft_tests", spec("id = 'soft.delete:1234'")))
+
+		var v struct{ Id string }
+		err := s.One(context.TODO(), query, &v)
+		assert.True(t, trail.IsNotFound(err))
+
+		var deleted struct {
+			Id        string
+			DeletedAt *time.Time
+		}
+		query := provider.NewSelectSpec("soft.delete.deleted:1234", builder.Select("id", "deleted_at").From("soft_tests").Where("id = ?", "soft.delete:1234"), "soft_tests")
+		assert.Nil(t, s.One(context.TODO(), query, &deleted, WithDeleted()))
+		assert.NotNil(t, deleted.DeletedAt)
+	})
+
+	t.Run("edit ignores deleted", func(t *testing.T) {
+		err := s.Edit(context.TODO(), "soft_tests", spec("id = 'soft.delete:1234'"), map[string]interface{}{"name": "foo"}, provider.WithMustMatch())
+		assert.True(t, trail.IsNotFound(err))
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		assert.Nil(t, s.Restore(context.TODO(), "soft_tests", spec("id = 'soft.delete:1234'")))
+
+		var v []struct{ Id string }
+		assert.Nil(t, s.All(context.TODO(), query, &v))
+		assert.Len(t, v, 1)
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		err := s.Purge(context.TODO(), "soft_tests", spec("id = 'soft.delete:1234'"), provider.WithMustMatch())
+		assert.True(t, trail.IsNotFound(err))
+
+		assert.Nil(t, s.Remove(context.TODO(), "soft_tests", spec("id = 'soft.delete:1234'")))
+		assert.Nil(t, s.Purge(context.TODO(), "soft_tests", spec("id = 'soft.delete:1234'")))
+
+		var v struct{ Id string }
+		err = s.One(context.TODO(), query, &v, WithDeleted())
+		assert.True(t, trail.IsNotFound(err))
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		_ = s.AddMany(context.TODO(), "soft_tests", []map[string]interface{}{{"id": "soft.delete.limit:1"}, {"id": "soft.delete.limit:2"}})
+		_ = s.Remove(context.TODO(), "soft_tests", spec("id = 'soft.delete.limit:1'"))
+
+		var v struct{ Id string }
+		query := provider.NewSelectSpec("soft.delete.limit", builder.Select("id").From("soft_tests").Where("id LIKE ?", "soft.delete.limit:%").OrderBy("id").Limit(1), "soft_tests")
+		assert.Nil(t, s.One(context.TODO(), query, &v))
+		assert.Equal(t, "soft.delete.limit:2", v.Id)
+	})
+
+	t.Run("join", func(t *testing.T) {
+		var v []struct{ Id string }
+		query := provider.NewSelectSpec("soft.delete.join", builder.Select("soft_tests.id").From("soft_tests").Join("tests ON tests.id = soft_tests.id"), "soft_tests", "tests")
+		assert.Nil(t, s.All(context.TODO(), query, &v))
+	})
+
+	t.Run("tagged raw spec", func(t *testing.T) {
+		var v struct{ Id string }
+		err := s.One(context.TODO(), spec("SELECT id FROM soft_tests WHERE id = 'soft.delete:1234'"), &v, QueryCollections("soft_tests"))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("not soft delete", func(t *testing.T) {
+		assert.NotNil(t, s.Restore(context.TODO(), "tests", spec("id = 'soft.delete:1234'")))
+		assert.NotNil(t, s.Purge(context.TODO(), "tests", spec("id = 'soft.delete:1234'")))
+	})
+}
+
+func TestStore_Invalidate(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT 'invalidate:1234' AS id")
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute)))
+		wait(store)
+
+		store.Invalidate(context.TODO(), query.Id())
+		_, present := store.cacheGet(context.TODO(), query.Id())
+		assert.False(t, present)
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT 'invalidate.tx:1234' AS id")
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if err := tx.One(query, &v, QueryTTL(time.Minute)); err != nil {
+				return err
+			}
+
+			tx.Invalidate(query.Id())
+			_, present := store.cacheGet(tx.Context(), query.Id())
+			assert.False(t, present)
+			return nil
+		}))
+	})
+
+	t.Run("counts", func(t *testing.T) {
+		query := spec("SELECT 'invalidate.count:1234' AS id")
+		_, err := store.Count(context.TODO(), query, QueryTTL(time.Minute))
+		assert.Nil(t, err)
+		_, err = store.Exists(context.TODO(), query, QueryTTL(time.Minute))
+		assert.Nil(t, err)
+		wait(store)
+
+		store.Invalidate(context.TODO(), query.Id())
+		_, present := store.cacheGet(context.TODO(), provider.CountSpec{Spec: query}.Id())
+		assert.False(t, present)
+		_, present = store.cacheGet(context.TODO(), provider.ExistsSpec{Spec: query}.Id())
+		assert.False(t, present)
+	})
+
+	t.Run("transaction counts", func(t *testing.T) {
+		query := spec("SELECT 'invalidate.tx.count:1234' AS id")
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if _, err := tx.Count(query, QueryTTL(time.Minute)); err != nil {
+				return err
+			}
+
+			tx.Invalidate(query.Id())
+			_, present := store.cacheGet(tx.Context(), provider.CountSpec{Spec: query}.Id())
+			assert.False(t, present)
+			return nil
+		}))
+	})
+}
+
+func TestStore_InvalidateCollection(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	t.Run("ok", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT 'invalidate.collection:1234' AS id")
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("invalidate.collection")))
+		wait(store)
+
+		store.InvalidateCollection(context.TODO(), "invalidate.collection")
+		_, present := store.cacheGet(context.TODO(), query.Id())
+		assert.False(t, present)
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT 'invalidate.collection.tx:1234' AS id")
+		assert.Nil(t, store.One(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("invalidate.collection.tx")))
+		wait(store)
+
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			tx.InvalidateCollection("invalidate.collection.tx")
+			_, present := store.cacheGet(tx.Context(), query.Id())
+			assert.False(t, present)
+
+			_, present = store.cacheGet(context.TODO(), query.Id())
+			assert.True(t, present)
+			return nil
+		}))
+
+		_, present := store.cacheGet(context.TODO(), query.Id())
+		assert.False(t, present)
+	})
+}
+
+func TestStore_PurgeCache(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	s := NewStore(store.db)
+
+	t.Run("transaction", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT 'purge.tx:1234' AS id")
+		assert.Nil(t, s.One(context.TODO(), query, &v, QueryTTL(time.Minute)))
+		wait(s)
+
+		assert.NotNil(t, s.Do(context.TODO(), func(tx Txn) error {
+			tx.PurgeCache()
+			_, present := s.cacheGet(tx.Context(), query.Id())
+			assert.False(t, present)
+			return trail.NewError("")
+		}))
+
+		_, present := s.cacheGet(context.TODO(), query.Id())
+		assert.True(t, present)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT 'purge:1234' AS id")
+		assert.Nil(t, s.One(context.TODO(), query, &v, QueryTTL(time.Minute)))
+		wait(s)
+
+		s.PurgeCache(context.TODO())
+		_, present := s.cacheGet(context.TODO(), query.Id())
+		assert.False(t, present)
+	})
+}
+
+func TestStore_TxnCache(t *testing.T) {
+	trail.Testing()
+	t.Parallel()
+
+	_ = store.Add(context.TODO(), "tests", map[string]interface{}{"id": "txn.cache:1234"})
+
+	t.Run("rollback", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT id FROM tests WHERE id = 'txn.cache:1234' AND 'rollback' = 'rollback'")
+		assert.NotNil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if err := tx.One(query, &v, QueryTTL(time.Minute)); err != nil {
+				return err
+			}
+
+			wait(store)
+			_, present := store.cache.Get(query.Id())
+			assert.False(t, present)
+
+			_, present = store.cacheGet(tx.Context(), query.Id())
+			assert.True(t, present)
+			return trail.NewError("")
+		}))
+
+		wait(store)
+		_, present := store.cache.Get(query.Id())
+		assert.False(t, present)
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		var v struct{ Id string }
+		query := spec("SELECT id FROM tests WHERE id = 'txn.cache:1234' AND 'commit' = 'commit'")
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			return tx.One(query, &v, QueryTTL(time.Minute))
+		}))
+
+		wait(store)
+		_, present := store.cache.Get(query.Id())
+		assert.True(t, present)
+	})
+
+	t.Run("written collections", func(t *testing.T) {
+		var v []struct{ Id string }
+		query := spec("SELECT id FROM tests WHERE id LIKE 'txn.cache.written:%'")
+		assert.Nil(t, store.All(context.TODO(), query, &v, QueryTTL(time.Minute), QueryCollections("tests")))
+		wait(store)
+
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if err := tx.Add("tests", map[string]interface{}{"id": "txn.cache.written:1234"}); err != nil {
+				return err
+			}
+
+			if err := tx.All(query, &v, QueryTTL(time.Minute), QueryCollections("tests")); err != nil {
+				return err
+			}
+
+			assert.Len(t, v, 1)
+			return nil
+		}))
+
+		wait(store)
+		_, present := store.cacheGet(context.TODO(), query.Id())
+		assert.False(t, present)
+	})
+	t.Run("byte ids", func(t *testing.T) {
+		var v struct{ Id string }
+		query := bytesSpec("SELECT id FROM tests WHERE id = 'txn.cache:1234' AND 'bytes' = 'bytes'")
+		assert.Nil(t, store.Do(context.TODO(), func(tx Txn) error {
+			if err := tx.One(query, &v, QueryTTL(time.Minute)); err != nil {
+				return err
+			}
+
+			if err := tx.One(query, &v, QueryTTL(time.Minute)); err != nil {
+				return err
+			}
+
+			return tx.Edit("tests", bytesSpec("id = 'txn.cache:1234'"), map[string]interface{}{"name": "bytes"})
+		}))
+		assert.Equal(t, "txn.cache:1234", v.Id)
+	})
+}
+
+// wait for buffered cache writes to be applied
+func wait(s *Store) {
+	if c, ok := s.cache.(interface{ Wait() }); ok {
+		c.Wait()
+	}
+}
+
+type nopCache struct{}
+
+func (nopCache) Get(interface{}) (interface{}, bool)                            { return nil, false }
+func (nopCache) SetWithTTL(interface{}, interface{}, int64, time.Duration) bool { return true }
+func (nopCache) Del(interface{})                                                {}
+func (nopCache) Clear()                                                         {}
+
+type countingProvider struct {
+	provider.Provider
+	reads *int32
+}
+
+func (p countingProvider) Repository() provider.Repository {
+	return countingRepository{Repository: p.Provider.Repository(), reads: p.reads}
+}
+
+type countingRepository struct {
+	provider.Repository
+	reads *int32
+}
+
+func (r countingRepository) One(ctx context.Context, spec provider.Spec, v interface{}) error {
+	atomic.AddInt32(r.reads, 1)
+	return r.Repository.One(ctx, spec, v)
+}
+
+func (r countingRepository) All(ctx context.Context, spec provider.Spec, v interface{}) error {
+	atomic.AddInt32(r.reads, 1)
+	return r.Repository.All(ctx, spec, v)
+}
+
+type bytesSpec string
+
+func (s bytesSpec) Id() interface{} {
+	return []byte(s)
+}
+
+func (s bytesSpec) ToSql() (string, []interface{}, error) {
+	return string(s), nil, nil
+}
+
 type spec string
 
 func (s spec) Id() interface{} {